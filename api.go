@@ -2,12 +2,19 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type SolutionPayload struct {
@@ -32,8 +39,202 @@ func getHeaders(cookie string) http.Header {
 	return headers
 }
 
-func getNextPuzzle(client *http.Client, headers http.Header) (*GetRatedNextResponse, error) {
-	req, err := http.NewRequest("POST", "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/GetNextRated", strings.NewReader("{}"))
+// HTMLResponseError is returned when chess.com answers an API call with an HTML page, usually a
+// Cloudflare challenge or an error page, instead of JSON
+type HTMLResponseError struct {
+	StatusCode int
+}
+
+func (e *HTMLResponseError) Error() string {
+	return fmt.Sprintf("got HTML response (status %d), cookie may be invalid or rate-limited", e.StatusCode)
+}
+
+// ErrInvalidCookie is returned when chess.com rejects the account's session cookie
+var ErrInvalidCookie = errors.New("cookie is invalid or expired")
+
+// checkResponse returns an HTMLResponseError when the response is an HTML page, so callers don't
+// try to unmarshal it and dump the whole page into their error, or an error wrapping
+// ErrInvalidCookie when chess.com refused the session. HTML is checked first: a Cloudflare
+// challenge comes back as an HTML 403 and says nothing about the cookie, which callers would
+// otherwise throw away
+func checkResponse(resp *http.Response, body []byte) error {
+	if strings.Contains(resp.Header.Get("Content-Type"), "text/html") || bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) {
+		return &HTMLResponseError{StatusCode: resp.StatusCode}
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w (%s)", ErrInvalidCookie, resp.Status)
+	}
+	return nil
+}
+
+// maxErrorBodyLength is how much of a response body error messages quote
+const maxErrorBodyLength = 200
+
+// summarizeBody returns body for an error message: on one line and cut to maxErrorBodyLength, so
+// an unexpected HTML page doesn't flood the logs
+func summarizeBody(body []byte) string {
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if len(text) <= maxErrorBodyLength {
+		return text
+	}
+	cut := maxErrorBodyLength
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s... (%d bytes)", text[:cut], len(body))
+}
+
+func getNextPuzzle(ctx context.Context, client *http.Client, headers http.Header) (*GetRatedNextResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/GetNextRated", strings.NewReader("{}"))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = headers
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, body); err != nil {
+		return nil, err
+	}
+
+	var puzzleResp GetRatedNextResponse
+	err = json.Unmarshal(body, &puzzleResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal puzzle response: %w. Response body: %s", err, summarizeBody(body))
+	}
+
+	if puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID == "" {
+		return nil, fmt.Errorf("got empty puzzle ID. Response body: %s", summarizeBody(body))
+	}
+
+	return &puzzleResp, nil
+}
+
+// ErrPuzzleNotFound is returned when chess.com has no puzzle with the requested ID
+var ErrPuzzleNotFound = errors.New("puzzle not found")
+
+// getPuzzleByID fetches a specific puzzle by its legacy ID, in the same shape as the rated stream
+func getPuzzleByID(ctx context.Context, client *http.Client, headers http.Header, id string) (*GetRatedNextResponse, error) {
+	payload, err := json.Marshal(map[string]string{"legacyPuzzleId": id})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/GetPuzzle", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = headers
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(resp, body); err != nil {
+		return nil, err
+	}
+
+	var rpcError struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(body, &rpcError)
+	if resp.StatusCode == http.StatusNotFound || rpcError.Code == "not_found" || rpcError.Code == "invalid_argument" {
+		return nil, fmt.Errorf("%w: %s", ErrPuzzleNotFound, id)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get puzzle %s: %s", id, resp.Status)
+	}
+
+	var puzzleResp GetRatedNextResponse
+	err = json.Unmarshal(body, &puzzleResp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal puzzle response: %w. Response body: %s", err, summarizeBody(body))
+	}
+
+	if puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrPuzzleNotFound, id)
+	}
+
+	return &puzzleResp, nil
+}
+
+// maxHistoryPageSize is the largest page chess.com returns for the attempt history
+const maxHistoryPageSize = 50
+
+// getRatedPuzzleHistory fetches up to limit of the account's most recent rated puzzle attempts,
+// following the page tokens until enough have been collected or the history runs out
+func getRatedPuzzleHistory(ctx context.Context, client *http.Client, headers http.Header, limit int) ([]PuzzleAttempt, error) {
+	var attempts []PuzzleAttempt
+	pageToken := ""
+	for len(attempts) < limit {
+		pageSize := min(limit-len(attempts), maxHistoryPageSize)
+		payload, err := json.Marshal(map[string]any{"pageSize": pageSize, "pageToken": pageToken})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/GetRatedAttemptHistory", bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header = headers
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkResponse(resp, body); err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get puzzle history: %s", resp.Status)
+		}
+
+		var page PuzzleAttemptHistoryResponse
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal puzzle history response: %w. Response body: %s", err, summarizeBody(body))
+		}
+
+		attempts = append(attempts, page.Attempts...)
+		if page.NextPageToken == "" || len(page.Attempts) == 0 {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	if len(attempts) > limit {
+		attempts = attempts[:limit]
+	}
+	return attempts, nil
+}
+
+func submitSolution(ctx context.Context, client *http.Client, headers http.Header, puzzleResp *GetRatedNextResponse, strategy *Strategy, incorrect bool) (*SubmitSolutionResponse, error) {
+	return postSolution(ctx, client, headers, "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/SubmitRatedSolution", puzzleResp, strategy, incorrect)
+}
+
+// getDailyPuzzle fetches today's puzzle of the day, which is unrated and separate from the rated stream
+func getDailyPuzzle(ctx context.Context, client *http.Client, headers http.Header) (*GetRatedNextResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/GetDailyPuzzle", strings.NewReader("{}"))
 	if err != nil {
 		return nil, err
 	}
@@ -49,42 +250,51 @@ func getNextPuzzle(client *http.Client, headers http.Header) (*GetRatedNextRespo
 	if err != nil {
 		return nil, err
 	}
+	if err := checkResponse(resp, body); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get daily puzzle: %s", resp.Status)
+	}
 
 	var puzzleResp GetRatedNextResponse
 	err = json.Unmarshal(body, &puzzleResp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal puzzle response: %w. Response body: %s", err, string(body))
+		return nil, fmt.Errorf("failed to unmarshal daily puzzle response: %w. Response body: %s", err, summarizeBody(body))
 	}
 
 	if puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID == "" {
-		return nil, fmt.Errorf("got empty puzzle ID. Response body: %s", string(body))
+		return nil, fmt.Errorf("got empty daily puzzle ID. Response body: %s", summarizeBody(body))
 	}
 
 	return &puzzleResp, nil
 }
 
-func submitSolution(client *http.Client, headers http.Header, puzzleResp *GetRatedNextResponse, strategy *Strategy) (*SubmitSolutionResponse, error) {
+// submitDailyPuzzle submits the solution of the daily puzzle, which has its own endpoint
+func submitDailyPuzzle(ctx context.Context, client *http.Client, headers http.Header, puzzleResp *GetRatedNextResponse, strategy *Strategy) (*SubmitSolutionResponse, error) {
+	return postSolution(ctx, client, headers, "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/SubmitDailySolution", puzzleResp, strategy, false)
+}
+
+// postSolution submits the puzzle's solution (or a wrong one when incorrect is set) to url
+func postSolution(ctx context.Context, client *http.Client, headers http.Header, url string, puzzleResp *GetRatedNextResponse, strategy *Strategy, incorrect bool) (*SubmitSolutionResponse, error) {
 	var moves []MoveType
 	for _, m := range puzzleResp.UserPuzzle.Puzzle.Moves {
 		moves = append(moves, m.Move)
 	}
-
-	var attemptDuration float64
-	switch strategy.TimeMode {
-	case "hour":
-		attemptDuration = 3600 + rand.Float64()*1800
-	case "legit":
-		attemptDuration = 15 + rand.Float64()*30
-	case "zero":
-		attemptDuration = 0.1 + rand.Float64()*0.3
-	default:
-		attemptDuration = 15.0
+	if incorrect {
+		wrong, err := incorrectMoves(puzzleResp, moves)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make an incorrect solution: %w", err)
+		}
+		moves = wrong
 	}
 
+	reported := reportedAttemptDuration(strategy, puzzleResp)
 	solution := SolutionPayload{
 		LegacyPuzzleID:  puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID,
 		Moves:           moves,
-		AttemptDuration: fmt.Sprintf("%.3fs", attemptDuration),
+		AttemptDuration: formatAPIDuration(reported),
 	}
 
 	payload, err := json.Marshal(solution)
@@ -92,7 +302,7 @@ func submitSolution(client *http.Client, headers http.Header, puzzleResp *GetRat
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleService/SubmitRatedSolution", bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
 	if err != nil {
 		return nil, err
 	}
@@ -108,20 +318,151 @@ func submitSolution(client *http.Client, headers http.Header, puzzleResp *GetRat
 	if err != nil {
 		return nil, err
 	}
+	if err := checkResponse(resp, body); err != nil {
+		return nil, err
+	}
 
 	var solutionResp SubmitSolutionResponse
 	err = json.Unmarshal(body, &solutionResp)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal solution response: %w. Response body: %s", err, string(body))
+		return nil, fmt.Errorf("failed to unmarshal solution response: %w. Response body: %s", err, summarizeBody(body))
 	}
-	solutionResp.AttemptDuration = attemptDuration
+	solutionResp.ReportedDuration = reported
 
 	return &solutionResp, nil
 }
 
-func getMembershipStatus(client *http.Client, cookie string) (*MembershipStatusResponse, error) {
+// randomDuration returns a uniformly random duration between lo and hi
+func randomDuration(lo, hi time.Duration) time.Duration {
+	return lo + time.Duration(rand.Int63n(int64(hi-lo)+1))
+}
+
+// reportedAttemptDuration picks the solve time sent to chess.com for the strategy's time mode. It
+// is only what gets reported, how long is actually waited between puzzles comes from solveDelay
+func reportedAttemptDuration(strategy *Strategy, puzzleResp *GetRatedNextResponse) time.Duration {
+	switch strategy.TimeMode {
+	case TimeModeHour:
+		return randomDuration(time.Hour, 90*time.Minute)
+	case TimeModeLegit:
+		return randomDuration(15*time.Second, 45*time.Second)
+	case TimeModeZero:
+		return randomDuration(100*time.Millisecond, 400*time.Millisecond)
+	case TimeModeRealistic:
+		return realisticAttemptDuration(puzzleResp)
+	default:
+		return 15 * time.Second
+	}
+}
+
+// solveDelay is how long to actually wait after a puzzle that was reported as solved in reported.
+// The legit and realistic modes report believable times, so the wait matches them. Hour and zero
+// mode times aren't meant to be believed, waiting an hour or no time at all would make them
+// unusable or give the bot away, so they wait a legit solve time instead
+func solveDelay(strategy *Strategy, reported time.Duration) time.Duration {
+	switch strategy.TimeMode {
+	case TimeModeLegit, TimeModeRealistic:
+		return reported
+	default:
+		return randomDuration(15*time.Second, 45*time.Second)
+	}
+}
+
+// formatAPIDuration formats d the way chess.com's protobuf durations are written, e.g. "12.345s"
+func formatAPIDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
+
+// parseAPIDuration parses protobuf-style durations such as "12.5s"
+func parseAPIDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSuffix(s, "s"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	if seconds < 0 || math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// realisticAttemptDuration samples a solve time around the projected target so harder puzzles take longer
+func realisticAttemptDuration(puzzleResp *GetRatedNextResponse) time.Duration {
+	projection := puzzleResp.UserPuzzle.UserPuzzleProjection
+
+	target, err := parseAPIDuration(projection.TargetSolutionDuration)
+	if err != nil || target == 0 {
+		// No usable projection, fall back to the legit range
+		return randomDuration(15*time.Second, 45*time.Second)
+	}
+
+	difficulty := strings.ToLower(projection.RelativeDifficulty)
+	switch {
+	case strings.Contains(difficulty, "easy"):
+		target = target * 4 / 5
+	case strings.Contains(difficulty, "hard"):
+		target = target * 5 / 4
+	}
+
+	// Humans are rarely exactly on target, vary between 60% and 140% of it
+	duration := time.Duration(float64(target) * (0.6 + rand.Float64()*0.8))
+	return max(duration, randomDuration(2*time.Second, 4*time.Second))
+}
+
+// incorrectMoves turns a solution into a deliberately wrong one: a random legal first move from the
+// puzzle's starting position other than the solution's, so chess.com scores it as a failed attempt
+// rather than rejecting it as malformed
+func incorrectMoves(puzzleResp *GetRatedNextResponse, moves []MoveType) ([]MoveType, error) {
+	if len(moves) == 0 {
+		return nil, fmt.Errorf("puzzle has no solution moves")
+	}
+	fen, err := puzzleStartFEN(puzzleResp)
+	if err != nil {
+		return nil, err
+	}
+	board, err := ParseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	solution := moves[0].From + moves[0].To
+	var candidates []MoveType
+	for _, uci := range board.LegalMoves() {
+		// Promotions to different pieces are the same move to chess.com, which only sends the squares
+		move := MoveType{From: uci[0:2], To: uci[2:4]}
+		if move.From+move.To != solution && !slices.Contains(candidates, move) {
+			candidates = append(candidates, move)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("the solution's first move is the only legal move")
+	}
+	return []MoveType{candidates[rand.Intn(len(candidates))]}, nil
+}
+
+// IsSolved reports whether chess.com accepted the submitted solution
+func (r *SubmitSolutionResponse) IsSolved() bool {
+	return isPassingResult(r.SolutionResult)
+}
+
+// Passed reports whether a past attempt was counted as solved
+func (a PuzzleAttempt) Passed() bool {
+	return isPassingResult(a.SolutionResult)
+}
+
+func isPassingResult(solutionResult string) bool {
+	result := strings.ToUpper(solutionResult)
+	if strings.Contains(result, "FAIL") || strings.Contains(result, "INCORRECT") {
+		return false
+	}
+	return strings.Contains(result, "PASS") || strings.Contains(result, "SUCCESS") || strings.Contains(result, "CORRECT")
+}
+
+func getMembershipStatus(ctx context.Context, client *http.Client, cookie string) (*MembershipStatusResponse, error) {
 	url := "https://www.chess.com/rpc/chesscom.payments.v1.ProductService/GetUserActiveMembership"
-	req, err := http.NewRequest("POST", url, strings.NewReader("{}"))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader("{}"))
 	if err != nil {
 		return nil, err
 	}
@@ -136,25 +477,28 @@ func getMembershipStatus(client *http.Client, cookie string) (*MembershipStatusR
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get membership status: %s", resp.Status)
-	}
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
+	if err := checkResponse(resp, body); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get membership status: %s", resp.Status)
+	}
 
 	var statusResp MembershipStatusResponse
 	if err := json.Unmarshal(body, &statusResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal membership status response: %w. Response body: %s", err, string(body))
+		return nil, fmt.Errorf("failed to unmarshal membership status response: %w. Response body: %s", err, summarizeBody(body))
 	}
 
 	return &statusResp, nil
 }
 
-func getTacticsStats(client *http.Client, cookie string) (*TacticsStatsResponse, error) {
-	req, err := http.NewRequest("GET", "https://www.chess.com/callback/tactics/stats/user", nil)
+func getTacticsStats(ctx context.Context, client *http.Client, cookie string) (*TacticsStatsResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://www.chess.com/callback/tactics/stats/user", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -170,18 +514,21 @@ func getTacticsStats(client *http.Client, cookie string) (*TacticsStatsResponse,
 	if err != nil {
 		return nil, err
 	}
+	if err := checkResponse(resp, body); err != nil {
+		return nil, err
+	}
 
 	var stats TacticsStatsResponse
 	err = json.Unmarshal(body, &stats)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal stats response: %w. Response body: %s", err, string(body))
+		return nil, fmt.Errorf("failed to unmarshal stats response: %w. Response body: %s", err, summarizeBody(body))
 	}
 
 	return &stats, nil
 }
 
-func getUserProfile(client *http.Client, cookie string) (*UserProfileResponse, error) {
-	req, err := http.NewRequest("POST", "https://www.chess.com/rpc/chesscom.user_profile.v1.UserProfileService/GetProfileSettings", bytes.NewBuffer([]byte("{\"fieldMask\":\"\"}")))
+func getUserProfile(ctx context.Context, client *http.Client, cookie string) (*UserProfileResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://www.chess.com/rpc/chesscom.user_profile.v1.UserProfileService/GetProfileSettings", bytes.NewBuffer([]byte("{\"fieldMask\":\"\"}")))
 	if err != nil {
 		return nil, err
 	}
@@ -198,6 +545,9 @@ func getUserProfile(client *http.Client, cookie string) (*UserProfileResponse, e
 	if err != nil {
 		return nil, err
 	}
+	if err := checkResponse(resp, body); err != nil {
+		return nil, err
+	}
 
 	var profileResp UserProfileResponse
 	err = json.Unmarshal(body, &profileResp)
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// testPuzzle returns a puzzle starting at fen whose solution starts with from-to
+func testPuzzle(t *testing.T, fen, from, to string) *GetRatedNextResponse {
+	t.Helper()
+	body := fmt.Sprintf(`{"userPuzzle":{"puzzle":{"legacyPuzzleId":"1","userPosition":%q,"moves":[{"move":{"from":%q,"to":%q}}]}}}`, fen, from, to)
+	var puzzleResp GetRatedNextResponse
+	if err := json.Unmarshal([]byte(body), &puzzleResp); err != nil {
+		t.Fatal(err)
+	}
+	return &puzzleResp
+}
+
+func TestIncorrectMoves(t *testing.T) {
+	tests := []struct {
+		name     string
+		fen      string
+		from, to string
+		wantErr  bool
+	}{
+		{name: "knight move", fen: "r3k3/8/8/8/8/8/3N4/4K3 w - - 0 1", from: "d2", to: "c4"},
+		{name: "rook mate", fen: "6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", from: "a1", to: "a8"},
+		{name: "promotion", fen: "8/4P3/8/8/8/8/k7/4K3 w - - 0 1", from: "e7", to: "e8"},
+		{name: "only legal move", fen: "k7/8/8/8/8/8/r7/7K w - - 0 1", from: "h1", to: "g1", wantErr: true},
+		{name: "no starting position", fen: "", from: "e2", to: "e4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			puzzleResp := testPuzzle(t, tt.fen, tt.from, tt.to)
+			solution := []MoveType{{From: tt.from, To: tt.to}}
+			// The move is random, try a few times
+			for range 20 {
+				moves, err := incorrectMoves(puzzleResp, solution)
+				if tt.wantErr {
+					if err == nil {
+						t.Fatalf("incorrectMoves() = %v, want an error", moves)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("incorrectMoves() error: %v", err)
+				}
+				if len(moves) != 1 {
+					t.Fatalf("incorrectMoves() = %v, want one move", moves)
+				}
+				if moves[0] == solution[0] {
+					t.Fatalf("incorrectMoves() returned the solution %v", moves[0])
+				}
+				board, _ := ParseFEN(tt.fen)
+				uci := moves[0].From + moves[0].To
+				if board.ApplyUCI(uci) != nil && board.ApplyUCI(uci+"q") != nil {
+					t.Fatalf("incorrectMoves() returned illegal move %s", uci)
+				}
+			}
+		})
+	}
+}
+
+// durationSamples is how often the randomized durations are sampled to check their range
+const durationSamples = 500
+
+func TestReportedAttemptDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       TimeModeType
+		target     string // Projected solve time, for the realistic mode
+		difficulty string
+		lo, hi     time.Duration
+	}{
+		{name: "hour", mode: TimeModeHour, lo: time.Hour, hi: 90 * time.Minute},
+		{name: "legit", mode: TimeModeLegit, lo: 15 * time.Second, hi: 45 * time.Second},
+		{name: "zero", mode: TimeModeZero, lo: 100 * time.Millisecond, hi: 400 * time.Millisecond},
+		{name: "realistic", mode: TimeModeRealistic, target: "30s", difficulty: "RELATIVE_DIFFICULTY_NORMAL", lo: 18 * time.Second, hi: 42 * time.Second},
+		{name: "realistic easy", mode: TimeModeRealistic, target: "30s", difficulty: "RELATIVE_DIFFICULTY_EASY", lo: 14400 * time.Millisecond, hi: 33600 * time.Millisecond},
+		{name: "realistic hard", mode: TimeModeRealistic, target: "30s", difficulty: "RELATIVE_DIFFICULTY_HARD", lo: 22500 * time.Millisecond, hi: 52500 * time.Millisecond},
+		{name: "realistic short target", mode: TimeModeRealistic, target: "1s", lo: 2 * time.Second, hi: 4 * time.Second},
+		{name: "realistic without projection", mode: TimeModeRealistic, lo: 15 * time.Second, hi: 45 * time.Second},
+		{name: "realistic bad projection", mode: TimeModeRealistic, target: "soon", lo: 15 * time.Second, hi: 45 * time.Second},
+		{name: "unknown", mode: "", lo: 15 * time.Second, hi: 15 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := &Strategy{TimeMode: tt.mode}
+			var puzzleResp GetRatedNextResponse
+			puzzleResp.UserPuzzle.UserPuzzleProjection.TargetSolutionDuration = tt.target
+			puzzleResp.UserPuzzle.UserPuzzleProjection.RelativeDifficulty = tt.difficulty
+
+			for range durationSamples {
+				got := reportedAttemptDuration(strategy, &puzzleResp)
+				if got < tt.lo || got > tt.hi {
+					t.Fatalf("reportedAttemptDuration = %v, want between %v and %v", got, tt.lo, tt.hi)
+				}
+			}
+		})
+	}
+}
+
+func TestSolveDelay(t *testing.T) {
+	tests := []struct {
+		mode     TimeModeType
+		reported time.Duration
+		matches  bool // Whether the delay is the reported time, a legit solve time otherwise
+	}{
+		{mode: TimeModeLegit, reported: 27 * time.Second, matches: true},
+		{mode: TimeModeRealistic, reported: 51 * time.Second, matches: true},
+		{mode: TimeModeHour, reported: 75 * time.Minute},
+		{mode: TimeModeZero, reported: 250 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			strategy := &Strategy{TimeMode: tt.mode}
+			for range durationSamples {
+				got := solveDelay(strategy, tt.reported)
+				if tt.matches {
+					if got != tt.reported {
+						t.Fatalf("solveDelay = %v, want the reported %v", got, tt.reported)
+					}
+				} else if got < 15*time.Second || got > 45*time.Second {
+					t.Fatalf("solveDelay = %v, want a legit solve time between 15s and 45s", got)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		contentType   string
+		body          string
+		invalidCookie bool
+		html          bool
+	}{
+		{name: "ok", status: http.StatusOK, contentType: "application/json", body: `{"rating":1500}`},
+		{name: "json 401", status: http.StatusUnauthorized, contentType: "application/json", body: `{"message":"unauthorized"}`, invalidCookie: true},
+		{name: "json 403", status: http.StatusForbidden, contentType: "application/json", body: `{"code":7}`, invalidCookie: true},
+		{name: "empty 401", status: http.StatusUnauthorized, invalidCookie: true},
+		{name: "cloudflare challenge 403", status: http.StatusForbidden, contentType: "text/html; charset=UTF-8", body: "<!DOCTYPE html><html><head><title>Just a moment...</title></head></html>", html: true},
+		{name: "html 403 without a content type", status: http.StatusForbidden, body: "  <html><body>Access denied</body></html>", html: true},
+		{name: "html 200", status: http.StatusOK, contentType: "text/html", body: "<html></html>", html: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status), Header: http.Header{}}
+			if tt.contentType != "" {
+				resp.Header.Set("Content-Type", tt.contentType)
+			}
+			err := checkResponse(resp, []byte(tt.body))
+
+			if got := errors.Is(err, ErrInvalidCookie); got != tt.invalidCookie {
+				t.Errorf("checkResponse error = %v, invalid cookie %v, want %v", err, got, tt.invalidCookie)
+			}
+			var htmlErr *HTMLResponseError
+			if got := errors.As(err, &htmlErr); got != tt.html {
+				t.Errorf("checkResponse error = %v, HTML %v, want %v", err, got, tt.html)
+			}
+			if tt.html && htmlErr.StatusCode != tt.status {
+				t.Errorf("HTML error status = %d, want %d", htmlErr.StatusCode, tt.status)
+			}
+			if !tt.invalidCookie && !tt.html && err != nil {
+				t.Errorf("checkResponse error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestSummarizeBody(t *testing.T) {
+	if got := summarizeBody([]byte("{\"error\":\n  \"bad request\"}\n")); got != `{"error": "bad request"}` {
+		t.Errorf("short body = %q, want it on one line", got)
+	}
+
+	page := []byte("<html>" + strings.Repeat("é", 300) + "</html>")
+	got := summarizeBody(page)
+	if !utf8.ValidString(got) {
+		t.Errorf("summary %q was cut inside a character", got)
+	}
+	if want := fmt.Sprintf("... (%d bytes)", len(page)); !strings.HasSuffix(got, want) {
+		t.Errorf("summary = %q, want it to end with %q", got, want)
+	}
+	if len(got) > maxErrorBodyLength+len("... (9999 bytes)") {
+		t.Errorf("summary is %d bytes long, want about %d", len(got), maxErrorBodyLength)
+	}
+}
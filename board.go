@@ -0,0 +1,452 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Board is a chess position with enough state to generate legal moves, indexed like squareIndex
+type Board struct {
+	squares     [64]byte // FEN piece letters, 0 for empty squares
+	whiteToMove bool
+	castling    string // Subset of "KQkq", empty when no castling is possible
+	epSquare    int    // En passant target square, -1 when there is none
+	halfmove    int
+	fullmove    int
+}
+
+// boardMove is a move in square indexes, promotion is a lowercase piece letter or 0
+type boardMove struct {
+	from, to  int
+	promotion byte
+}
+
+func (m boardMove) UCI() string {
+	uci := squareName(m.from) + squareName(m.to)
+	if m.promotion != 0 {
+		uci += string(m.promotion)
+	}
+	return uci
+}
+
+var (
+	knightSteps   = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps     = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookDirs      = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopDirs    = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	promotionKeys = []byte{'q', 'r', 'b', 'n'}
+)
+
+// ParseFEN builds a board from a FEN, the move counters and castling/en passant fields are optional
+func ParseFEN(fen string) (*Board, error) {
+	squares, side, err := fenPlacement(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	board := &Board{
+		squares:     squares,
+		whiteToMove: side == "w",
+		epSquare:    -1,
+		fullmove:    1,
+	}
+
+	fields := strings.Fields(fen)
+	if len(fields) > 2 && fields[2] != "-" {
+		board.castling = fields[2]
+	}
+	if len(fields) > 3 && fields[3] != "-" {
+		if board.epSquare, err = squareIndex(fields[3]); err != nil {
+			return nil, fmt.Errorf("invalid FEN '%s': %w", fen, err)
+		}
+	}
+	if len(fields) > 4 {
+		if board.halfmove, err = strconv.Atoi(fields[4]); err != nil {
+			return nil, fmt.Errorf("invalid FEN '%s': bad halfmove clock", fen)
+		}
+	}
+	if len(fields) > 5 {
+		if board.fullmove, err = strconv.Atoi(fields[5]); err != nil {
+			return nil, fmt.Errorf("invalid FEN '%s': bad fullmove number", fen)
+		}
+	}
+
+	return board, nil
+}
+
+// boardFromTCN replays a chess.com TCN move list from the starting position
+func boardFromTCN(moves string) (*Board, error) {
+	board, err := ParseFEN(startingFEN)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(moves); i += 2 {
+		uci, err := chessComMoveToUCI(moves[i : i+2])
+		if err != nil {
+			return nil, err
+		}
+		if err := board.ApplyUCI(uci); err != nil {
+			return nil, fmt.Errorf("move %d: %w", i/2+1, err)
+		}
+	}
+	return board, nil
+}
+
+// FEN renders the board as a FEN string
+func (b *Board) FEN() string {
+	var placement strings.Builder
+	for rank := 7; rank >= 0; rank-- {
+		empty := 0
+		for file := 0; file < 8; file++ {
+			piece := b.squares[rank*8+file]
+			if piece == 0 {
+				empty++
+				continue
+			}
+			if empty > 0 {
+				placement.WriteString(strconv.Itoa(empty))
+				empty = 0
+			}
+			placement.WriteByte(piece)
+		}
+		if empty > 0 {
+			placement.WriteString(strconv.Itoa(empty))
+		}
+		if rank > 0 {
+			placement.WriteByte('/')
+		}
+	}
+
+	side := "b"
+	if b.whiteToMove {
+		side = "w"
+	}
+	castling := b.castling
+	if castling == "" {
+		castling = "-"
+	}
+	ep := "-"
+	if b.epSquare >= 0 {
+		ep = squareName(b.epSquare)
+	}
+	return fmt.Sprintf("%s %s %s %s %d %d", placement.String(), side, castling, ep, b.halfmove, b.fullmove)
+}
+
+// samePosition reports whether two FENs have the same piece placement and side to move
+func samePosition(a, b string) bool {
+	fieldsA, fieldsB := strings.Fields(a), strings.Fields(b)
+	if len(fieldsA) < 2 || len(fieldsB) < 2 {
+		return false
+	}
+	return fieldsA[0] == fieldsB[0] && fieldsA[1] == fieldsB[1]
+}
+
+func isWhitePiece(piece byte) bool {
+	return piece >= 'A' && piece <= 'Z'
+}
+
+func isOwnPiece(piece byte, white bool) bool {
+	return piece != 0 && isWhitePiece(piece) == white
+}
+
+// offset returns the square df files and dr ranks away from sq, or -1 when that leaves the board
+func offset(sq, df, dr int) int {
+	file, rank := sq%8+df, sq/8+dr
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return -1
+	}
+	return rank*8 + file
+}
+
+// attacked reports whether sq is attacked by the given side
+func (b *Board) attacked(sq int, byWhite bool) bool {
+	pawn, knight, bishop, rook, queen, king := byte('p'), byte('n'), byte('b'), byte('r'), byte('q'), byte('k')
+	pawnRank := 1
+	if byWhite {
+		pawn, knight, bishop, rook, queen, king = 'P', 'N', 'B', 'R', 'Q', 'K'
+		pawnRank = -1
+	}
+
+	for _, df := range []int{-1, 1} {
+		if from := offset(sq, df, pawnRank); from >= 0 && b.squares[from] == pawn {
+			return true
+		}
+	}
+	for _, step := range knightSteps {
+		if from := offset(sq, step[0], step[1]); from >= 0 && b.squares[from] == knight {
+			return true
+		}
+	}
+	for _, step := range kingSteps {
+		if from := offset(sq, step[0], step[1]); from >= 0 && b.squares[from] == king {
+			return true
+		}
+	}
+	for _, dirs := range []struct {
+		steps  [][2]int
+		slider byte
+	}{{rookDirs, rook}, {bishopDirs, bishop}} {
+		for _, dir := range dirs.steps {
+			for from := offset(sq, dir[0], dir[1]); from >= 0; from = offset(from, dir[0], dir[1]) {
+				piece := b.squares[from]
+				if piece == 0 {
+					continue
+				}
+				if piece == dirs.slider || piece == queen {
+					return true
+				}
+				break
+			}
+		}
+	}
+	return false
+}
+
+func (b *Board) kingSquare(white bool) int {
+	king := byte('k')
+	if white {
+		king = 'K'
+	}
+	for sq, piece := range b.squares {
+		if piece == king {
+			return sq
+		}
+	}
+	return -1
+}
+
+// InCheck reports whether the side to move is in check
+func (b *Board) InCheck() bool {
+	king := b.kingSquare(b.whiteToMove)
+	return king >= 0 && b.attacked(king, !b.whiteToMove)
+}
+
+// pseudoLegalMoves generates moves for the side to move without checking whether they leave the king in check
+func (b *Board) pseudoLegalMoves() []boardMove {
+	var moves []boardMove
+	white := b.whiteToMove
+
+	for from, piece := range b.squares {
+		if !isOwnPiece(piece, white) {
+			continue
+		}
+
+		switch piece | 0x20 { // Lowercase
+		case 'p':
+			moves = append(moves, b.pawnMoves(from)...)
+		case 'n':
+			moves = append(moves, b.stepMoves(from, knightSteps)...)
+		case 'b':
+			moves = append(moves, b.slideMoves(from, bishopDirs)...)
+		case 'r':
+			moves = append(moves, b.slideMoves(from, rookDirs)...)
+		case 'q':
+			moves = append(moves, b.slideMoves(from, rookDirs)...)
+			moves = append(moves, b.slideMoves(from, bishopDirs)...)
+		case 'k':
+			moves = append(moves, b.stepMoves(from, kingSteps)...)
+			moves = append(moves, b.castlingMoves(from)...)
+		}
+	}
+
+	return moves
+}
+
+func (b *Board) stepMoves(from int, steps [][2]int) []boardMove {
+	var moves []boardMove
+	for _, step := range steps {
+		to := offset(from, step[0], step[1])
+		if to >= 0 && !isOwnPiece(b.squares[to], b.whiteToMove) {
+			moves = append(moves, boardMove{from: from, to: to})
+		}
+	}
+	return moves
+}
+
+func (b *Board) slideMoves(from int, dirs [][2]int) []boardMove {
+	var moves []boardMove
+	for _, dir := range dirs {
+		for to := offset(from, dir[0], dir[1]); to >= 0; to = offset(to, dir[0], dir[1]) {
+			if isOwnPiece(b.squares[to], b.whiteToMove) {
+				break
+			}
+			moves = append(moves, boardMove{from: from, to: to})
+			if b.squares[to] != 0 {
+				break
+			}
+		}
+	}
+	return moves
+}
+
+func (b *Board) pawnMoves(from int) []boardMove {
+	forward, startRank, lastRank := 1, 1, 7
+	if !b.whiteToMove {
+		forward, startRank, lastRank = -1, 6, 0
+	}
+
+	var targets []int
+	if one := offset(from, 0, forward); one >= 0 && b.squares[one] == 0 {
+		targets = append(targets, one)
+		if two := offset(from, 0, 2*forward); from/8 == startRank && b.squares[two] == 0 {
+			targets = append(targets, two)
+		}
+	}
+	for _, df := range []int{-1, 1} {
+		to := offset(from, df, forward)
+		if to < 0 {
+			continue
+		}
+		if target := b.squares[to]; (target != 0 && !isOwnPiece(target, b.whiteToMove)) || to == b.epSquare {
+			targets = append(targets, to)
+		}
+	}
+
+	var moves []boardMove
+	for _, to := range targets {
+		if to/8 != lastRank {
+			moves = append(moves, boardMove{from: from, to: to})
+			continue
+		}
+		for _, promotion := range promotionKeys {
+			moves = append(moves, boardMove{from: from, to: to, promotion: promotion})
+		}
+	}
+	return moves
+}
+
+func (b *Board) castlingMoves(from int) []boardMove {
+	home, kingSide, queenSide, rook := 4, "K", "Q", byte('R')
+	if !b.whiteToMove {
+		home, kingSide, queenSide, rook = 60, "k", "q", 'r'
+	}
+	if from != home || b.attacked(home, !b.whiteToMove) {
+		return nil
+	}
+
+	var moves []boardMove
+	if strings.Contains(b.castling, kingSide) && b.squares[home+3] == rook &&
+		b.squares[home+1] == 0 && b.squares[home+2] == 0 &&
+		!b.attacked(home+1, !b.whiteToMove) && !b.attacked(home+2, !b.whiteToMove) {
+		moves = append(moves, boardMove{from: home, to: home + 2})
+	}
+	if strings.Contains(b.castling, queenSide) && b.squares[home-4] == rook &&
+		b.squares[home-1] == 0 && b.squares[home-2] == 0 && b.squares[home-3] == 0 &&
+		!b.attacked(home-1, !b.whiteToMove) && !b.attacked(home-2, !b.whiteToMove) {
+		moves = append(moves, boardMove{from: home, to: home - 2})
+	}
+	return moves
+}
+
+// legalMoves generates every legal move for the side to move
+func (b *Board) legalMoves() []boardMove {
+	var legal []boardMove
+	for _, move := range b.pseudoLegalMoves() {
+		next := *b
+		next.apply(move)
+		if king := next.kingSquare(b.whiteToMove); king >= 0 && !next.attacked(king, !b.whiteToMove) {
+			legal = append(legal, move)
+		}
+	}
+	return legal
+}
+
+// LegalMoves returns every legal move for the side to move in UCI notation
+func (b *Board) LegalMoves() []string {
+	moves := b.legalMoves()
+	ucis := make([]string, len(moves))
+	for i, move := range moves {
+		ucis[i] = move.UCI()
+	}
+	return ucis
+}
+
+// IsLegal reports whether the UCI move is legal in this position
+func (b *Board) IsLegal(uci string) bool {
+	for _, move := range b.legalMoves() {
+		if move.UCI() == uci {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyUCI plays a UCI move, returning an error when it isn't legal
+func (b *Board) ApplyUCI(uci string) error {
+	for _, move := range b.legalMoves() {
+		if move.UCI() == uci {
+			b.apply(move)
+			return nil
+		}
+	}
+	return fmt.Errorf("illegal move %s in %s", uci, b.FEN())
+}
+
+// apply makes a move without checking it, updating castling rights, en passant and the move counters
+func (b *Board) apply(move boardMove) {
+	piece := b.squares[move.from]
+	captured := b.squares[move.to]
+	isPawn := piece|0x20 == 'p'
+
+	if isPawn && move.to == b.epSquare && captured == 0 {
+		// En passant removes the pawn behind the target square
+		if b.whiteToMove {
+			b.squares[move.to-8] = 0
+		} else {
+			b.squares[move.to+8] = 0
+		}
+		captured = 'p'
+	}
+
+	if piece|0x20 == 'k' {
+		switch move.to - move.from {
+		case 2:
+			b.squares[move.from+1], b.squares[move.from+3] = b.squares[move.from+3], 0
+		case -2:
+			b.squares[move.from-1], b.squares[move.from-4] = b.squares[move.from-4], 0
+		}
+	}
+
+	b.squares[move.to] = piece
+	b.squares[move.from] = 0
+	if move.promotion != 0 {
+		if b.whiteToMove {
+			b.squares[move.to] = move.promotion - 0x20
+		} else {
+			b.squares[move.to] = move.promotion
+		}
+	}
+
+	for _, sq := range []int{move.from, move.to} {
+		switch sq {
+		case 4:
+			b.castling = strings.NewReplacer("K", "", "Q", "").Replace(b.castling)
+		case 60:
+			b.castling = strings.NewReplacer("k", "", "q", "").Replace(b.castling)
+		case 0:
+			b.castling = strings.ReplaceAll(b.castling, "Q", "")
+		case 7:
+			b.castling = strings.ReplaceAll(b.castling, "K", "")
+		case 56:
+			b.castling = strings.ReplaceAll(b.castling, "q", "")
+		case 63:
+			b.castling = strings.ReplaceAll(b.castling, "k", "")
+		}
+	}
+
+	b.epSquare = -1
+	if isPawn && (move.to-move.from == 16 || move.from-move.to == 16) {
+		b.epSquare = (move.from + move.to) / 2
+	}
+
+	if isPawn || captured != 0 {
+		b.halfmove = 0
+	} else {
+		b.halfmove++
+	}
+	if !b.whiteToMove {
+		b.fullmove++
+	}
+	b.whiteToMove = !b.whiteToMove
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// OpeningBook maps positions to weighted book moves. Books are either Polyglot .bin files or text
+// files with one move per line:
+//
+//	<FEN> <uci move> [weight]
+//
+// Only the placement, side to move and castling fields of the FEN are matched, so move counters
+// and en passant squares may be omitted. Blank lines and lines starting with # are ignored.
+type OpeningBook struct {
+	entries  map[string][]BookMove // Text books, by bookKey
+	polyglot map[uint64][]BookMove // Polyglot books, by polyglotKey
+}
+
+// BookMove is a candidate move for a book position
+type BookMove struct {
+	Move   string
+	Weight int
+}
+
+// bookKey reduces a FEN to the fields a book position is matched on
+func bookKey(fen string) string {
+	fields := strings.Fields(fen)
+	if len(fields) > 3 {
+		fields = fields[:3]
+	}
+	for len(fields) < 3 {
+		fields = append(fields, "-")
+	}
+	return strings.Join(fields, " ")
+}
+
+// LoadOpeningBook reads an opening book, files ending in .bin as Polyglot books and anything else
+// as a text book
+func LoadOpeningBook(path string) (*OpeningBook, error) {
+	if strings.EqualFold(filepath.Ext(path), ".bin") {
+		return loadPolyglotBook(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	book := &OpeningBook{entries: make(map[string][]BookMove)}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		weight := 1
+		if n, err := strconv.Atoi(fields[len(fields)-1]); err == nil {
+			weight = n
+			fields = fields[:len(fields)-1]
+		}
+		if len(fields) < 3 || weight <= 0 {
+			return nil, fmt.Errorf("%s line %d: expected '<fen> <move> [weight]'", path, lineNumber)
+		}
+
+		fen := strings.Join(fields[:len(fields)-1], " ")
+		move := fields[len(fields)-1]
+		board, err := ParseFEN(fen)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, lineNumber, err)
+		}
+		if !board.IsLegal(move) {
+			return nil, fmt.Errorf("%s line %d: %s is not legal in %s", path, lineNumber, move, fen)
+		}
+
+		key := bookKey(fen)
+		book.entries[key] = append(book.entries[key], BookMove{Move: move, Weight: weight})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return book, nil
+}
+
+// Lookup returns the book moves for a position, nil when it is out of book
+func (b *OpeningBook) Lookup(fen string) []BookMove {
+	if b == nil {
+		return nil
+	}
+	if b.polyglot == nil {
+		return b.entries[bookKey(fen)]
+	}
+
+	board, err := ParseFEN(fen)
+	if err != nil {
+		return nil
+	}
+	var moves []BookMove
+	for _, move := range b.polyglot[polyglotKey(board)] {
+		move.Move = polyglotBookMove(board, move.Move)
+		// Keys can collide, a move that isn't legal here belongs to another position
+		if board.IsLegal(move.Move) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// PickMove chooses a book move for the position at random, weighted by the move weights
+func (b *OpeningBook) PickMove(fen string) (string, bool) {
+	moves := b.Lookup(fen)
+	total := 0
+	for _, move := range moves {
+		total += move.Weight
+	}
+	if total == 0 {
+		return "", false
+	}
+
+	pick := rand.Intn(total)
+	for _, move := range moves {
+		if pick < move.Weight {
+			return move.Move, true
+		}
+		pick -= move.Weight
+	}
+	return "", false
+}
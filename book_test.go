@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolyglotKey(t *testing.T) {
+	// Keys from the Polyglot book format specification
+	tests := []struct {
+		moves string
+		want  uint64
+	}{
+		{moves: "", want: 0x463b96181691fc9c},
+		{moves: "e2e4", want: 0x823c9b50fd114196},
+		{moves: "e2e4 d7d5", want: 0x0756b94461c50fb0},
+		{moves: "e2e4 d7d5 e4e5", want: 0x662fafb965db29d4},
+		{moves: "e2e4 d7d5 e4e5 f7f5", want: 0x22a48b5a8e47ff78},
+		{moves: "e2e4 d7d5 e4e5 f7f5 e1e2", want: 0x652a607ca3f242c1},
+		{moves: "e2e4 d7d5 e4e5 f7f5 e1e2 e8f7", want: 0x00fdd303c946bdd9},
+		{moves: "a2a4 b7b5 h2h4 b5b4 c2c4", want: 0x3c8123ea7b067637},
+		{moves: "a2a4 b7b5 h2h4 b5b4 c2c4 b4c3 a1a3", want: 0x5c3f9b829b279560},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.moves, func(t *testing.T) {
+			board, err := ParseFEN(startFEN)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, move := range strings.Fields(tt.moves) {
+				if err := board.ApplyUCI(move); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := polyglotKey(board); got != tt.want {
+				t.Errorf("polyglotKey = %016x, want %016x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolyglotBookLookup(t *testing.T) {
+	// book.bin has e2e4 (10) and d2d4 (5) from the start, e7e5 (3) and c7c5 (0) after 1.e4, both
+	// castles for White stored as the king taking its rook, and a promotion
+	book, err := LoadOpeningBook(filepath.Join("testdata", "book.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fen  string
+		want []BookMove
+	}{
+		{
+			name: "start",
+			fen:  startFEN,
+			want: []BookMove{{Move: "e2e4", Weight: 10}, {Move: "d2d4", Weight: 5}},
+		},
+		{
+			name: "move counters don't matter",
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 4 12",
+			want: []BookMove{{Move: "e2e4", Weight: 10}, {Move: "d2d4", Weight: 5}},
+		},
+		{
+			name: "after e2e4",
+			fen:  "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+			want: []BookMove{{Move: "e7e5", Weight: 3}, {Move: "c7c5", Weight: 0}},
+		},
+		{
+			name: "castling",
+			fen:  "r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R3K2R w KQkq - 0 1",
+			want: []BookMove{{Move: "e1g1", Weight: 2}, {Move: "e1c1", Weight: 1}},
+		},
+		{
+			name: "promotion",
+			fen:  "8/4P3/8/8/8/8/k7/4K3 w - - 0 1",
+			want: []BookMove{{Move: "e7e8q", Weight: 1}},
+		},
+		{
+			name: "out of book",
+			fen:  "rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR b KQkq - 0 1",
+		},
+		{
+			name: "other side to move",
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR b KQkq - 0 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := book.Lookup(tt.fen); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for range 20 {
+		move, ok := book.PickMove(startFEN)
+		if !ok || (move != "e2e4" && move != "d2d4") {
+			t.Fatalf("PickMove = %q, %v, want e2e4 or d2d4", move, ok)
+		}
+	}
+	// A weight of 0 is never picked
+	for range 20 {
+		if move, _ := book.PickMove("rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"); move != "e7e5" {
+			t.Fatalf("PickMove after e2e4 = %q, want e7e5", move)
+		}
+	}
+}
+
+func TestLoadPolyglotBookRejectsTruncated(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "book.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "truncated.bin")
+	if err := os.WriteFile(path, data[:len(data)-3], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOpeningBook(path); err == nil {
+		t.Fatal("LoadOpeningBook of a truncated book succeeded, want an error")
+	}
+}
+
+func TestLoadTextBook(t *testing.T) {
+	book, err := LoadOpeningBook("opening_book.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moves := book.Lookup(startFEN); len(moves) == 0 {
+		t.Error("the example text book has no moves for the starting position")
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var checkAccountsCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check which accounts have working cookies",
+	Long:  "Checks every account's membership status and profile without solving puzzles, and classifies it as healthy, expired cookie or errored. Does not modify db.json unless --prune is given.",
+	Run:   checkAccounts,
+}
+
+var (
+	checkPrune  bool
+	checkNotify bool
+)
+
+func init() {
+	checkAccountsCmd.Flags().BoolVar(&checkPrune, "prune", false, "Invalidate the cookies of accounts found to be expired")
+	checkAccountsCmd.Flags().BoolVar(&checkNotify, "notify", false, "Send the results to the configured webhooks")
+}
+
+type AccountHealth string
+
+const (
+	AccountHealthy       AccountHealth = "healthy"
+	AccountCookieExpired AccountHealth = "expired cookie"
+	AccountErrored       AccountHealth = "errored"
+)
+
+type AccountCheckResult struct {
+	Key      string
+	Username string
+	Health   AccountHealth
+	Detail   string
+}
+
+// checkAccount verifies an account's cookie against the membership and profile endpoints
+func checkAccount(ctx context.Context, client *http.Client, key string, account Account) AccountCheckResult {
+	result := AccountCheckResult{Key: key, Username: account.Username, Health: AccountHealthy}
+
+	if account.Cookie == "" {
+		result.Health = AccountCookieExpired
+		result.Detail = "cookie is empty"
+		return result
+	}
+
+	client, err := accountHTTPClient(client, &account)
+	if err != nil {
+		result.Health = AccountErrored
+		result.Detail = err.Error()
+		return result
+	}
+
+	membership, err := getMembershipStatus(ctx, client, account.Cookie)
+	if err != nil {
+		result.Health = AccountErrored
+		if errors.Is(err, ErrInvalidCookie) {
+			result.Health = AccountCookieExpired
+		}
+		result.Detail = err.Error()
+		return result
+	}
+
+	profile, err := getUserProfile(ctx, client, account.Cookie)
+	if err != nil {
+		result.Health = AccountErrored
+		if errors.Is(err, ErrInvalidCookie) {
+			result.Health = AccountCookieExpired
+		}
+		result.Detail = err.Error()
+		return result
+	}
+	if profile.UserProfileSettings.Username == "" {
+		result.Health = AccountCookieExpired
+		result.Detail = "profile returned no username"
+		return result
+	}
+
+	result.Detail = membership.MembershipLevel
+	return result
+}
+
+// checkAllAccounts checks every account in db, at most MaxConcurrentAccounts at a time, and returns
+// the results sorted by username
+func checkAllAccounts(ctx context.Context, client *http.Client, appConfig *AppConfig, db *Database) []AccountCheckResult {
+	semaphore := make(chan struct{}, appConfig.concurrencyLimit(len(db.Accounts)))
+
+	var wg sync.WaitGroup
+	var resultsMu sync.Mutex
+	var results []AccountCheckResult
+	for key, account := range db.Accounts {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(key string, account Account) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			result := checkAccount(ctx, client, key, account)
+			resultsMu.Lock()
+			results = append(results, result)
+			resultsMu.Unlock()
+		}(key, account)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Username < results[j].Username
+	})
+	return results
+}
+
+func checkAccounts(cmd *cobra.Command, args []string) {
+	appConfig, err := loadAppConfig(configPath)
+	if err != nil {
+		log.Fatalf("failed to load app config: %v", err)
+	}
+
+	// Only --prune writes the database, a plain check shouldn't wait for or block a running command
+	load := readDatabase
+	if checkPrune {
+		load = loadDatabase
+	}
+	db, err := load(dbPath)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	if len(db.Accounts) == 0 {
+		logger.Println("No accounts found in db.json.")
+		return
+	}
+
+	client := newHTTPClient(appConfig)
+
+	logger.Printf("Checking %d accounts...\n", len(db.Accounts))
+	results := checkAllAccounts(context.Background(), client, appConfig, db)
+
+	var table strings.Builder
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ACCOUNT\tSTATUS\tDETAIL")
+	for _, result := range results {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", result.Username, result.Health, result.Detail)
+	}
+	writer.Flush()
+	logger.Printf("%s", table.String())
+
+	var healthy, expired, errored []string
+	pruned := 0
+	for _, result := range results {
+		switch result.Health {
+		case AccountHealthy:
+			healthy = append(healthy, result.Username)
+		case AccountCookieExpired:
+			expired = append(expired, result.Username)
+			if checkPrune {
+				account := db.Accounts[result.Key]
+				if account.Cookie != "" {
+					account.Cookie = ""
+					db.Accounts[result.Key] = account
+					pruned++
+				}
+			}
+		case AccountErrored:
+			errored = append(errored, fmt.Sprintf("%s: %s", result.Username, result.Detail))
+		}
+	}
+
+	if checkPrune && pruned > 0 {
+		if err := saveDatabase(dbPath, db); err != nil {
+			log.Fatalf("failed to save database: %v", err)
+		}
+		logger.Printf("Invalidated %d expired cookies. Run `accounts prune` to remove those accounts.\n", pruned)
+	}
+
+	if checkNotify {
+		embed := Embed{
+			Title:       "chesshook2 account check",
+			Description: fmt.Sprintf("%d healthy, %d expired, %d errored.", len(healthy), len(expired), len(errored)),
+			Color:       3066993, // Green
+			Timestamp:   time.Now().Format(time.RFC3339),
+		}
+		if len(expired) > 0 || len(errored) > 0 {
+			embed.Color = 15158332 // Red
+		}
+		if len(healthy) > 0 {
+			embed.Fields = append(embed.Fields, EmbedField{Name: "✅ Healthy", Value: strings.Join(healthy, "\n"), Inline: false})
+		}
+		if len(expired) > 0 {
+			embed.Fields = append(embed.Fields, EmbedField{Name: "⚠️ Expired cookie", Value: strings.Join(expired, "\n"), Inline: false})
+		}
+		if len(errored) > 0 {
+			embed.Fields = append(embed.Fields, EmbedField{Name: "❌ Errored", Value: strings.Join(errored, "\n"), Inline: false})
+		}
+		newNotifier(appConfig).Send(WebhookPayload{Embeds: fitEmbeds(embed)})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep running and solve puzzles for each account once its cooldown has elapsed",
+	Long:  "Runs the puzzle solver on a schedule. Each account is processed once per day, and the daemon sleeps until the next account is due (or at most the check interval). config.json and strategies.json are read again before every check, or right away on SIGHUP.",
+	Run:   runDaemon,
+}
+
+var daemonInterval time.Duration
+
+func init() {
+	daemonCmd.Flags().DurationVar(&daemonInterval, "interval", time.Hour, "Maximum time to sleep between checks for due accounts")
+}
+
+const accountCooldown = 24 * time.Hour
+
+func runDaemon(cmd *cobra.Command, args []string) {
+	if daemonInterval <= 0 {
+		log.Fatalf("--interval must be positive, got %s", daemonInterval)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	configs, err := NewConfigStore()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	configs.ReloadOnSignal(ctx)
+	appConfig := configs.Current().App
+
+	client := newHTTPClient(appConfig)
+
+	logger.Printf("Daemon started, checking for due accounts at least every %s.\n", daemonInterval)
+	newNotifier(appConfig).Send(WebhookPayload{Embeds: []Embed{{
+		Title:       "chesshook2 daemon started",
+		Description: fmt.Sprintf("Checking for due accounts at least every %s.", daemonInterval),
+		Color:       3447003,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}}})
+
+	// Accounts that errored don't get a new LastRun, so remember when they were tried
+	lastAttempt := make(map[string]time.Time)
+
+	for {
+		// Reload every cycle so edits to the config files are picked up, SIGHUP does it right away.
+		// A broken edit keeps the daemon going with the last good files
+		if _, err := configs.Reload(); err != nil {
+			logger.Errorf("Keeping the current config: %v\n", err)
+		}
+		loaded := configs.Current()
+		appConfig = loaded.App
+		db, shutdown, err := runDueAccounts(ctx, client, appConfig, loaded.Strategies, lastAttempt)
+		// Other commands may use the database while the daemon sleeps, it is reloaded next cycle
+		unlockDatabase(dbPath)
+		if shutdown {
+			logger.Println("Received shutdown signal, exiting daemon.")
+			return
+		}
+
+		var wake time.Time
+		if err != nil {
+			// A database that is locked by another command or can't be read or saved right now
+			// shouldn't end the daemon, the due accounts are tried again next cycle
+			wake = time.Now().Add(daemonInterval)
+			logger.Errorf("Daemon cycle failed, trying again at %s: %v\n", wake.Format(time.RFC822), err)
+		} else {
+			wake = scheduleNextCheck(appConfig, db, lastAttempt)
+		}
+
+		logger.Infof("Sleeping until %s.\n", wake.Format(time.RFC822))
+		timer := time.NewTimer(time.Until(wake))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Println("Received shutdown signal, exiting daemon.")
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// runDueAccounts is one daemon cycle: it loads db.json, runs the accounts that are due and saves
+// the database, recording the attempts in lastAttempt. shutdown reports that ctx was cancelled
+// during the run
+func runDueAccounts(ctx context.Context, client *http.Client, appConfig *AppConfig, strategies map[string]Strategy, lastAttempt map[string]time.Time) (db *Database, shutdown bool, err error) {
+	db, err = loadDatabase(dbPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to load database: %w", err)
+	}
+
+	now := time.Now()
+	var dueKeys []string
+	for key, account := range db.Accounts {
+		if !nextDaemonRun(account, lastAttempt[key]).After(now) {
+			dueKeys = append(dueKeys, key)
+		}
+	}
+	if len(dueKeys) == 0 {
+		return db, false, nil
+	}
+
+	logger.Infof("%d account(s) due, starting run.\n", len(dueKeys))
+	notifier := newNotifier(appConfig)
+	sendRunStart(notifier, db, dueKeys, false)
+	results := solveAccounts(ctx, client, appConfig, notifier, db, strategies, dueKeys, false)
+	for _, key := range dueKeys {
+		lastAttempt[key] = time.Now()
+	}
+	if err := saveDatabase(dbPath, db); err != nil {
+		return nil, false, fmt.Errorf("failed to save database: %w", err)
+	}
+	sendRunSummary(newSummaryNotifier(appConfig), results, false, appConfig.DiscordMentionOnError)
+	return db, ctx.Err() != nil, nil
+}
+
+// scheduleNextCheck returns when the next account is due, at most daemonInterval from now, and
+// sends a heartbeat naming the accounts due then
+func scheduleNextCheck(appConfig *AppConfig, db *Database, lastAttempt map[string]time.Time) time.Time {
+	wake := time.Now().Add(daemonInterval)
+	var nextAccounts []string
+	for key, account := range db.Accounts {
+		next := nextDaemonRun(account, lastAttempt[key])
+		if next.Before(wake) {
+			wake = next
+			nextAccounts = []string{account.Username}
+		} else if next.Equal(wake) {
+			nextAccounts = append(nextAccounts, account.Username)
+		}
+	}
+
+	heartbeat := Embed{
+		Title:       "chesshook2 daemon heartbeat",
+		Description: fmt.Sprintf("Next check at %s.", wake.Format(time.RFC822)),
+		Color:       3447003,
+		Timestamp:   time.Now().Format(time.RFC3339),
+	}
+	if len(nextAccounts) > 0 {
+		heartbeat.Fields = []EmbedField{{Name: "Next accounts", Value: strings.Join(nextAccounts, "\n"), Inline: false}}
+	}
+	newNotifier(appConfig).Send(WebhookPayload{Embeds: fitEmbeds(heartbeat)})
+	return wake
+}
+
+// nextDaemonRun returns when an account should next be processed by the daemon
+func nextDaemonRun(account Account, lastAttempt time.Time) time.Time {
+	next := account.LastRun.Add(accountCooldown)
+	if retry := lastAttempt.Add(daemonInterval); retry.After(next) {
+		next = retry
+	}
+	return next
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var distributeAccountsCmd = &cobra.Command{
+	Use:   "distribute [strategy=weight...]",
+	Short: "Assign strategies to all accounts by weight",
+	Long:  "Assigns a strategy to every account in db.json so the strategies are used in proportion to their weights, e.g. `accounts distribute default=70 aggressive=30`. Without arguments the strategy_weights from config.json are used. Accounts are shuffled before assignment, pass --seed to make the result reproducible.",
+	Run:   distributeAccounts,
+}
+
+var distributeSeed int64
+
+func init() {
+	distributeAccountsCmd.Flags().Int64Var(&distributeSeed, "seed", 0, "Seed for the shuffle, the same seed and accounts give the same assignment (0 picks a random one)")
+}
+
+// parseStrategyWeights parses strategy=weight arguments
+func parseStrategyWeights(args []string) (map[string]int, error) {
+	weights := make(map[string]int, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected strategy=weight, got '%s'", arg)
+		}
+		weight, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for '%s': %w", name, err)
+		}
+		weights[name] = weight
+	}
+	return weights, nil
+}
+
+// strategyQuotas splits count accounts between the strategies in proportion to their weights,
+// handing the accounts left over from rounding down to the largest remainders
+func strategyQuotas(weights map[string]int, count int) (map[string]int, []string) {
+	names := make([]string, 0, len(weights))
+	total := 0
+	for name, weight := range weights {
+		names = append(names, name)
+		total += weight
+	}
+	sort.Strings(names)
+
+	quotas := make(map[string]int, len(names))
+	remainders := make(map[string]int, len(names))
+	assigned := 0
+	for _, name := range names {
+		quotas[name] = count * weights[name] / total
+		remainders[name] = count * weights[name] % total
+		assigned += quotas[name]
+	}
+
+	byRemainder := append([]string(nil), names...)
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return remainders[byRemainder[i]] > remainders[byRemainder[j]]
+	})
+	for i := 0; assigned < count; i++ {
+		quotas[byRemainder[i%len(byRemainder)]]++
+		assigned++
+	}
+	return quotas, names
+}
+
+func distributeAccounts(cmd *cobra.Command, args []string) {
+	weights, err := parseStrategyWeights(args)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if len(weights) == 0 {
+		appConfig, err := loadAppConfig(configPath)
+		if err != nil {
+			log.Fatalf("Failed to load app config: %v", err)
+		}
+		weights = appConfig.StrategyWeights
+	}
+	if len(weights) == 0 {
+		log.Fatalf("No weights given, pass strategy=weight arguments or set strategy_weights in config.json.")
+	}
+
+	strategies, err := loadStrategies(strategiesPath)
+	if err != nil {
+		log.Fatalf("Failed to load strategies: %v", err)
+	}
+	for name, weight := range weights {
+		if _, ok := strategies[name]; !ok {
+			log.Fatalf("Strategy '%s' not found in strategies.json.", name)
+		}
+		if weight < 0 {
+			log.Fatalf("Weight for '%s' must not be negative.", name)
+		}
+	}
+
+	db, err := loadDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to load database: %v", err)
+	}
+	if len(db.Accounts) == 0 {
+		logger.Println("No accounts found in db.json.")
+		return
+	}
+
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	if total == 0 {
+		log.Fatalf("At least one weight must be positive.")
+	}
+
+	// Sorted first so a seed always shuffles the same list the same way
+	keys := make([]string, 0, len(db.Accounts))
+	for key := range db.Accounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	seed := distributeSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rand.New(rand.NewSource(seed)).Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+
+	quotas, names := strategyQuotas(weights, len(keys))
+	next := 0
+	for _, name := range names {
+		for _, key := range keys[next : next+quotas[name]] {
+			account := db.Accounts[key]
+			if account.StrategyName != name {
+				logger.Printf("Changed strategy for account '%s' from '%s' to '%s'.\n", account.Username, account.StrategyName, name)
+			}
+			account.StrategyName = name
+			db.Accounts[key] = account
+		}
+		next += quotas[name]
+	}
+
+	if err := saveDatabase(dbPath, db); err != nil {
+		log.Fatalf("Failed to save database: %v", err)
+	}
+
+	var summary []string
+	for _, name := range names {
+		summary = append(summary, fmt.Sprintf("%s: %d", name, quotas[name]))
+	}
+	logger.Printf("Distributed %d accounts (seed %d): %s\n", len(keys), seed, strings.Join(summary, ", "))
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"encoding/json"
 	"log"
-	"net/http"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -37,10 +37,44 @@ var gameSeekCmd = &cobra.Command{
 	Run:   runGameSeek,
 }
 
+var (
+	gameEnginePath string
+	gameThreads    int
+	gameHash       int
+	gameMultiPV    int
+	gameDepth      int
+	gameSyzygyPath string
+	gameUCIOptions map[string]string
+	maxGames       int
+	seekTimeout    time.Duration
+)
+
 func init() {
 	gameCmd.AddCommand(gamePlayCmd)
 	gameCmd.AddCommand(gamePlayOneCmd)
 	gameCmd.AddCommand(gameSeekCmd)
+
+	gameSeekCmd.Flags().DurationVar(&seekTimeout, "timeout", 2*time.Minute, "How long to wait for an opponent to accept the seek")
+
+	gameCmd.PersistentFlags().StringVar(&gameEnginePath, "engine-path", "stockfish", "Path to the UCI engine binary")
+	gameCmd.PersistentFlags().IntVar(&gameThreads, "threads", 4, "Engine threads")
+	gameCmd.PersistentFlags().IntVar(&gameHash, "hash", 256, "Engine hash size in MB")
+	gameCmd.PersistentFlags().IntVar(&gameMultiPV, "multipv", 3, "Number of principal variations the engine searches")
+	gameCmd.PersistentFlags().IntVar(&maxGames, "max-games", 4, "Maximum number of games played at the same time per account")
+	gameCmd.PersistentFlags().IntVar(&gameDepth, "depth", 20, "Search depth, 0 to search for the strategy's think time instead (overridden by a strategy's depth)")
+	gameCmd.PersistentFlags().StringVar(&gameSyzygyPath, "syzygy-path", "", "Directories with Syzygy tablebases for the engine, separated by ':'")
+	gameCmd.PersistentFlags().StringToStringVar(&gameUCIOptions, "uci-option", nil, "Extra UCI option for the engine as name=value, may be repeated")
+}
+
+// startGameEngine starts the engine configured by the game command flags
+func startGameEngine() *ChessEngine {
+	engine := NewChessEngine(gameEnginePath, gameThreads, gameHash, gameMultiPV, gameDepth)
+	engine.Options = gameUCIOptions
+	engine.SetSyzygyPath(gameSyzygyPath)
+	if err := engine.Start(); err != nil {
+		log.Fatalf("Failed to start engine: %v", err)
+	}
+	return engine
 }
 
 func loadGameStrategies(path string) (map[string]GameStrategy, error) {
@@ -66,12 +100,12 @@ func loadGameStrategies(path string) (map[string]GameStrategy, error) {
 }
 
 func runGamePlay(cmd *cobra.Command, args []string) {
-	db, err := loadDatabase("db.json")
+	db, err := readDatabase(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to load database: %v", err)
 	}
 
-	strategies, err := loadGameStrategies("game_strategies.json")
+	strategies, err := loadGameStrategies(gameStrategiesPath)
 	if err != nil {
 		log.Fatalf("Failed to load game strategies: %v", err)
 	}
@@ -81,28 +115,29 @@ func runGamePlay(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	// Initialize engine
-	// Note: Engine path should be configurable
-	engine := NewChessEngine("stockfish", 4, 256, 3, 20)
-	if err := engine.Start(); err != nil {
-		log.Fatalf("Failed to start engine: %v", err)
+	appConfig, err := loadAppConfig(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load app config: %v", err)
 	}
+	notifier := newNotifier(appConfig)
+
+	engine := startGameEngine()
 	defer engine.Stop()
 
-	client := &http.Client{}
+	client := newHTTPClient(appConfig)
 
-	for username, account := range db.Accounts {
-		logger.Printf("Processing games for account: %s\n", username)
+	for _, account := range db.Accounts {
+		logger.Printf("Processing games for account: %s\n", account.Username)
 
 		strategy, ok := strategies["default"]
 		if !ok {
-			logger.Printf("Warning: default strategy not found, skipping %s\n", username)
+			logger.Printf("Warning: default strategy not found, skipping %s\n", account.Username)
 			continue
 		}
 
-		err := PlayAllGamesForAccount(client, &account, &strategy, engine)
+		err := PlayAllGamesForAccount(client, &account, &strategy, engine, notifier, maxGames)
 		if err != nil {
-			logger.Printf("Error playing games for %s: %v\n", username, err)
+			logger.Printf("Error playing games for %s: %v\n", account.Username, err)
 		}
 	}
 
@@ -112,17 +147,18 @@ func runGamePlay(cmd *cobra.Command, args []string) {
 func runGamePlayOne(cmd *cobra.Command, args []string) {
 	username := args[0]
 
-	db, err := loadDatabase("db.json")
+	db, err := readDatabase(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to load database: %v", err)
 	}
 
-	account, ok := db.Accounts[username]
+	key, ok := db.FindAccount(username)
 	if !ok {
 		log.Fatalf("Account '%s' not found in db.json", username)
 	}
+	account := db.Accounts[key]
 
-	strategies, err := loadGameStrategies("game_strategies.json")
+	strategies, err := loadGameStrategies(gameStrategiesPath)
 	if err != nil {
 		log.Fatalf("Failed to load game strategies: %v", err)
 	}
@@ -132,16 +168,18 @@ func runGamePlayOne(cmd *cobra.Command, args []string) {
 		log.Fatalf("Default strategy not found in game_strategies.json")
 	}
 
-	// Initialize engine
-	engine := NewChessEngine("stockfish", 4, 256, 3, 20)
-	if err := engine.Start(); err != nil {
-		log.Fatalf("Failed to start engine: %v", err)
+	appConfig, err := loadAppConfig(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load app config: %v", err)
 	}
+	notifier := newNotifier(appConfig)
+
+	engine := startGameEngine()
 	defer engine.Stop()
 
-	client := &http.Client{}
+	client := newHTTPClient(appConfig)
 
-	err = PlayAllGamesForAccount(client, &account, &strategy, engine)
+	err = PlayAllGamesForAccount(client, &account, &strategy, engine, notifier, maxGames)
 	if err != nil {
 		log.Fatalf("Error playing games: %v", err)
 	}
@@ -153,17 +191,16 @@ func runGameSeek(cmd *cobra.Command, args []string) {
 	username := args[0]
 	timeControl := args[1]
 
-	db, err := loadDatabase("db.json")
+	db, err := readDatabase(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to load database: %v", err)
 	}
 
-	account, ok := db.Accounts[username]
+	key, ok := db.FindAccount(username)
 	if !ok {
 		log.Fatalf("Account '%s' not found in db.json", username)
 	}
-
-	client := &http.Client{}
+	account := db.Accounts[key]
 
 	seek := GameSeekRequest{
 		TimeControl: timeControl,
@@ -172,14 +209,18 @@ func runGameSeek(cmd *cobra.Command, args []string) {
 		RatingMax:   3000,
 	}
 
-	logger.Printf("Creating game seek for %s with time control %s...\n", username, timeControl)
+	logger.Printf("Creating game seek for %s with time control %s, waiting up to %s for an opponent...\n", username, timeControl, seekTimeout)
+
+	if _, _, err := parseTimeControl(timeControl); err != nil {
+		log.Fatalf("%v", err)
+	}
 
-	gameInfo, err := CreateGameSeek(client, account.Cookie, seek)
+	gameInfo, err := CreateGameSeek(&account, seek, seekTimeout)
 	if err != nil {
 		log.Fatalf("Failed to create game seek: %v", err)
 	}
 
-	logger.Printf("Game seek created successfully!\n")
+	logger.Printf("Opponent found, game started!\n")
 	if gameInfo != nil {
 		logger.Printf("Game ID: %s\n", gameInfo.GameID)
 		logger.Printf("Game URL: %s\n", gameInfo.GameURL)
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var puzzleCmd = &cobra.Command{
+	Use:   "puzzle",
+	Short: "Work with individual puzzles",
+	Long:  "Commands for solving specific puzzles outside of the regular rated run",
+}
+
+var puzzleSolveCmd = &cobra.Command{
+	Use:   "solve [username] [puzzleId]",
+	Short: "Solve a specific puzzle by its ID",
+	Long:  "Fetches the puzzle with the given legacy ID and submits its solution for the account, using the account's strategy time mode.",
+	Args:  cobra.ExactArgs(2),
+	Run:   runPuzzleSolve,
+}
+
+var puzzleDailyCmd = &cobra.Command{
+	Use:   "daily [username]",
+	Short: "Solve the daily puzzle",
+	Long:  "Solves chess.com's puzzle of the day, which doesn't affect rating. Does nothing if the account already solved it today.",
+	Args:  cobra.ExactArgs(1),
+	Run:   runPuzzleDaily,
+}
+
+var dailyNotify bool
+
+func init() {
+	puzzleCmd.AddCommand(puzzleSolveCmd)
+	puzzleCmd.AddCommand(puzzleDailyCmd)
+
+	puzzleDailyCmd.Flags().BoolVar(&dailyNotify, "notify", false, "Send the result to the configured webhooks")
+}
+
+func runPuzzleSolve(cmd *cobra.Command, args []string) {
+	username, puzzleID := args[0], args[1]
+
+	db, err := readDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	key, ok := db.FindAccount(username)
+	if !ok {
+		log.Fatalf("Account with username '%s' not found in db.json.", username)
+	}
+	account := db.Accounts[key]
+
+	strategy := &Strategy{Name: "default", TimeMode: TimeModeLegit}
+	strategies, err := loadStrategies(strategiesPath)
+	if err != nil {
+		logger.Printf("Could not load strategies, using the legit time mode: %v\n", err)
+	} else if s, ok := strategies[account.StrategyName]; ok {
+		strategy = &s
+	}
+
+	client, err := accountHTTPClient(newHTTPClient(nil), &account)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ctx := context.Background()
+	headers := getHeaders(account.Cookie)
+
+	logger.Printf("[%s] Fetching puzzle %s...\n", account.Username, puzzleID)
+	puzzleResp, err := getPuzzleByID(ctx, client, headers, puzzleID)
+	if errors.Is(err, ErrPuzzleNotFound) {
+		log.Fatalf("Puzzle %s does not exist.", puzzleID)
+	}
+	if err != nil {
+		log.Fatalf("failed to get puzzle %s: %v", puzzleID, err)
+	}
+
+	logger.Printf("[%s] Submitting solution for puzzle %s...\n", account.Username, puzzleID)
+	solutionResp, err := submitSolution(ctx, client, headers, puzzleResp, strategy, false)
+	if err != nil {
+		log.Fatalf("failed to submit solution: %v", err)
+	}
+
+	solved := SolvedPuzzle{
+		PuzzleID:  puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID,
+		Timestamp: time.Now(),
+		TimeTaken: solutionResp.ReportedDuration.Seconds(),
+		Success:   solutionResp.IsSolved(),
+	}
+	if len(solutionResp.UserRatings) > 0 {
+		solved.RatingBefore = solutionResp.UserRatings[0].PreviousRating
+		solved.RatingAfter = solutionResp.UserRatings[0].Rating
+	}
+	if err := appendHistory(historyPath, HistoryEntry{AccountID: account.ID, Username: account.Username, SolvedPuzzle: solved}); err != nil {
+		logger.Printf("[%s] could not record puzzle history: %v\n", account.Username, err)
+	}
+
+	logger.Printf("[%s] Puzzle %s result: %s (%.1fs)\n", account.Username, puzzleID, solutionResp.SolutionResult, solutionResp.ReportedDuration.Seconds())
+	if len(solutionResp.UserRatings) > 0 {
+		rating := solutionResp.UserRatings[0]
+		logger.Printf("[%s] Rating: %d -> %d (%+d)\n", account.Username, rating.PreviousRating, rating.Rating, rating.RatingChange)
+	}
+}
+
+func runPuzzleDaily(cmd *cobra.Command, args []string) {
+	username := args[0]
+
+	db, err := loadDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+
+	key, ok := db.FindAccount(username)
+	if !ok {
+		log.Fatalf("Account with username '%s' not found in db.json.", username)
+	}
+	account := db.Accounts[key]
+
+	today := time.Now().Format(time.DateOnly)
+	if account.LastDailyPuzzle == today {
+		logger.Printf("[%s] Daily puzzle already solved today, nothing to do.\n", account.Username)
+		return
+	}
+
+	client, err := accountHTTPClient(newHTTPClient(nil), &account)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	ctx := context.Background()
+	headers := getHeaders(account.Cookie)
+
+	logger.Printf("[%s] Fetching the daily puzzle...\n", account.Username)
+	puzzleResp, err := getDailyPuzzle(ctx, client, headers)
+	if err != nil {
+		log.Fatalf("failed to get daily puzzle: %v", err)
+	}
+
+	puzzleID := puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID
+	logger.Printf("[%s] Submitting solution for daily puzzle %s...\n", account.Username, puzzleID)
+	solutionResp, err := submitDailyPuzzle(ctx, client, headers, puzzleResp, &Strategy{Name: "daily", TimeMode: TimeModeLegit})
+	if err != nil {
+		log.Fatalf("failed to submit daily puzzle: %v", err)
+	}
+	logger.Printf("[%s] Daily puzzle %s result: %s (%.1fs)\n", account.Username, puzzleID, solutionResp.SolutionResult, solutionResp.ReportedDuration.Seconds())
+
+	if solutionResp.IsSolved() {
+		account.LastDailyPuzzle = today
+		db.Accounts[key] = account
+		if err := saveDatabase(dbPath, db); err != nil {
+			log.Fatalf("failed to save database: %v", err)
+		}
+	}
+
+	if dailyNotify {
+		appConfig, err := loadAppConfig(configPath)
+		if err != nil {
+			log.Fatalf("failed to load app config: %v", err)
+		}
+
+		color := 3066993 // Green
+		description := fmt.Sprintf("Solved daily puzzle %s.", puzzleID)
+		if !solutionResp.IsSolved() {
+			color = 15158332 // Red
+			description = fmt.Sprintf("Daily puzzle %s was not accepted (%s).", puzzleID, solutionResp.SolutionResult)
+		}
+		newNotifier(appConfig).Send(WebhookPayload{Embeds: []Embed{{
+			Title:       fmt.Sprintf("Daily puzzle for %s", account.Username),
+			Description: description,
+			Color:       color,
+			Timestamp:   time.Now().Format(time.RFC3339),
+		}}})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var puzzleRushCmd = &cobra.Command{
+	Use:   "puzzlerush [username]",
+	Short: "Play a Puzzle Rush",
+	Long:  "Starts a Puzzle Rush for the account and solves puzzles until the clock or the strikes run out, then reports the score. Each puzzle is given a random solve time between --min-solve and --max-solve, and the last one is only attempted if it fits in the remaining time.",
+	Args:  cobra.ExactArgs(1),
+	Run:   runPuzzleRush,
+}
+
+// rushModes maps the --mode values to chess.com's rush modes
+var rushModes = map[string]string{
+	"3min":     RushModeThreeMinutes,
+	"5min":     RushModeFiveMinutes,
+	"survival": RushModeSurvival,
+}
+
+const (
+	// rushSubmitMargin is kept free at the end of a timed rush so the last submission arrives in time
+	rushSubmitMargin = 1500 * time.Millisecond
+	// defaultSurvivalPuzzles caps survival mode when --max-puzzles isn't given, as it has no clock
+	defaultSurvivalPuzzles = 50
+)
+
+var (
+	rushMode       string
+	rushMaxPuzzles int
+	rushMinSolve   time.Duration
+	rushMaxSolve   time.Duration
+	rushNotify     bool
+)
+
+func init() {
+	puzzleRushCmd.Flags().StringVar(&rushMode, "mode", "3min", "Rush mode: 3min, 5min or survival")
+	puzzleRushCmd.Flags().IntVar(&rushMaxPuzzles, "max-puzzles", 0, "Stop after this many puzzles (0 for no limit, survival defaults to 50)")
+	puzzleRushCmd.Flags().DurationVar(&rushMinSolve, "min-solve", 2*time.Second, "Shortest time spent on a puzzle")
+	puzzleRushCmd.Flags().DurationVar(&rushMaxSolve, "max-solve", 5*time.Second, "Longest time spent on a puzzle")
+	puzzleRushCmd.Flags().BoolVar(&rushNotify, "notify", false, "Send the result to the configured webhooks")
+}
+
+// RushResult summarizes a finished rush
+type RushResult struct {
+	Mode           string
+	Score          int
+	Attempted      int
+	Strikes        int
+	HighScore      int
+	IsNewHighScore bool
+	Duration       time.Duration
+}
+
+func runPuzzleRush(cmd *cobra.Command, args []string) {
+	username := args[0]
+
+	mode, ok := rushModes[rushMode]
+	if !ok {
+		log.Fatalf("Unknown rush mode '%s', use 3min, 5min or survival.", rushMode)
+	}
+	if rushMinSolve <= 0 || rushMaxSolve < rushMinSolve {
+		log.Fatalf("--min-solve must be positive and not greater than --max-solve.")
+	}
+	maxPuzzles := rushMaxPuzzles
+	if maxPuzzles == 0 && mode == RushModeSurvival {
+		maxPuzzles = defaultSurvivalPuzzles
+	}
+
+	db, err := readDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("failed to load database: %v", err)
+	}
+	key, ok := db.FindAccount(username)
+	if !ok {
+		log.Fatalf("Account with username '%s' not found in db.json.", username)
+	}
+	account := db.Accounts[key]
+
+	client, err := accountHTTPClient(newHTTPClient(nil), &account)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	headers := getHeaders(account.Cookie)
+
+	// Ctrl+C ends the rush early, it is still finished so the score counts
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := playPuzzleRush(ctx, client, headers, &account, mode, maxPuzzles)
+	if err != nil {
+		log.Fatalf("Puzzle Rush failed: %v", err)
+	}
+
+	logger.Printf("[%s] Puzzle Rush (%s) finished with a score of %d after %d puzzles and %d strikes in %s.\n", account.Username, rushMode, result.Score, result.Attempted, result.Strikes, result.Duration.Round(time.Second))
+	if result.IsNewHighScore {
+		logger.Printf("[%s] New high score!\n", account.Username)
+	}
+
+	if rushNotify {
+		appConfig, err := loadAppConfig(configPath)
+		if err != nil {
+			log.Fatalf("failed to load app config: %v", err)
+		}
+		newNotifier(appConfig).Send(WebhookPayload{Embeds: []Embed{buildRushEmbed(&account, result)}})
+	}
+}
+
+// playPuzzleRush starts a rush and solves puzzles until it is over, the clock runs out, maxPuzzles
+// (when positive) have been attempted or ctx is cancelled, then finishes it
+func playPuzzleRush(ctx context.Context, client *http.Client, headers http.Header, account *Account, mode string, maxPuzzles int) (*RushResult, error) {
+	startCtx, cancel := requestContext(ctx, nil)
+	session, err := startRush(startCtx, client, headers, mode)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start rush: %w", err)
+	}
+	started := time.Now()
+
+	var deadline time.Time
+	if session.TimeLimit != "" {
+		limit, err := parseAPIDuration(session.TimeLimit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rush time limit: %w", err)
+		}
+		deadline = started.Add(limit - rushSubmitMargin)
+		logger.Printf("[%s] Puzzle Rush started, %s on the clock.\n", account.Username, limit)
+	} else {
+		logger.Printf("[%s] Puzzle Rush started without a clock.\n", account.Username)
+	}
+
+	result := &RushResult{Mode: session.Mode}
+	for ctx.Err() == nil && (maxPuzzles <= 0 || result.Attempted < maxPuzzles) {
+		puzzleCtx, cancel := requestContext(ctx, nil)
+		puzzleResp, err := getNextRushPuzzle(puzzleCtx, client, headers, session.RushID)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, fmt.Errorf("failed to get rush puzzle: %w", err)
+		}
+		fetched := time.Now()
+
+		solveTime := rushMinSolve + time.Duration(rand.Int63n(int64(rushMaxSolve-rushMinSolve)+1))
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining < rushMinSolve {
+				logger.Printf("[%s] Not enough time left for another puzzle.\n", account.Username)
+				break
+			}
+			solveTime = min(solveTime, remaining)
+		}
+
+		select {
+		case <-time.After(solveTime):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		submitCtx, cancel := requestContext(ctx, nil)
+		solutionResp, err := submitRushSolution(submitCtx, client, headers, session.RushID, puzzleResp, time.Since(fetched))
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("failed to submit rush solution: %w", err)
+		}
+		result.Attempted++
+		result.Score = solutionResp.Score
+		result.Strikes = solutionResp.Strikes
+		logger.Printf("[%s] Rush puzzle %d (%s): %s, score %d, strikes %d\n", account.Username, result.Attempted, puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID, solutionResp.SolutionResult, solutionResp.Score, solutionResp.Strikes)
+
+		if solutionResp.RushOver || (session.MaxStrikes > 0 && solutionResp.Strikes >= session.MaxStrikes) {
+			break
+		}
+	}
+
+	// Finished even when interrupted, otherwise the score isn't recorded
+	finishCtx, cancel := requestContext(context.WithoutCancel(ctx), nil)
+	defer cancel()
+	finishResp, err := finishRush(finishCtx, client, headers, session.RushID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish rush: %w", err)
+	}
+	result.Score = finishResp.Score
+	result.HighScore = finishResp.HighScore
+	result.IsNewHighScore = finishResp.IsNewHighScore
+	result.Duration = time.Since(started)
+	return result, nil
+}
+
+func buildRushEmbed(account *Account, result *RushResult) Embed {
+	color := 3447003 // Blue
+	description := fmt.Sprintf("Scored %d in Puzzle Rush.", result.Score)
+	if result.IsNewHighScore {
+		color = 3066993 // Green
+		description = fmt.Sprintf("New Puzzle Rush high score: %d!", result.Score)
+	}
+	return Embed{
+		Title:       fmt.Sprintf("Puzzle Rush for %s", account.Username),
+		Description: description,
+		Color:       color,
+		Fields: []EmbedField{
+			{Name: "🏁 Score", Value: fmt.Sprintf("%d", result.Score), Inline: true},
+			{Name: "🏆 High score", Value: fmt.Sprintf("%d", result.HighScore), Inline: true},
+			{Name: "❌ Strikes", Value: fmt.Sprintf("%d", result.Strikes), Inline: true},
+			{Name: "🧩 Attempted", Value: fmt.Sprintf("%d", result.Attempted), Inline: true},
+			{Name: "⏱️ Duration", Value: result.Duration.Round(time.Second).String(), Inline: true},
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+}
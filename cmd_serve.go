@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -15,27 +22,106 @@ var serveCmd = &cobra.Command{
 }
 
 var (
-	uiPort     int
-	enginePort int
+	uiPort        int
+	enginePort    int
+	rotatePasskey bool
+	corsOrigins   []string
+	uiHost        string
+	authUser      string
+	authPassHash  string
+	withEngine    bool
 )
 
+var hashPasswordCmd = &cobra.Command{
+	Use:   "hash-password",
+	Short: "Hash a password for --auth-password-hash",
+	Long:  "Reads a password from stdin and prints the hash to pass to `serve --auth-password-hash` or set in CHESSHOOK_UI_PASSWORD_HASH.",
+	Args:  cobra.NoArgs,
+	Run:   runHashPassword,
+}
+
 func init() {
 	serveCmd.Flags().IntVar(&uiPort, "ui-port", 3000, "Port for web UI")
 	serveCmd.Flags().IntVar(&enginePort, "engine-port", 8080, "Port for engine WebSocket server")
+	serveCmd.Flags().BoolVar(&withEngine, "with-engine", false, "Start the engine server on --engine-port right away instead of from the web UI")
+	serveCmd.Flags().BoolVar(&rotatePasskey, "rotate-passkey", false, "Replace the saved engine passkey with a new one before starting")
+	serveCmd.Flags().StringVar(&uiHost, "ui-host", "localhost", "Interface the web UI listens on, anything but localhost needs --auth-user and --auth-password-hash")
+	serveCmd.Flags().StringVar(&authUser, "auth-user", "", "Username required by the web UI (HTTP Basic auth)")
+	serveCmd.Flags().StringVar(&authPassHash, "auth-password-hash", "", "Password hash from `serve hash-password` required by the web UI, defaults to $CHESSHOOK_UI_PASSWORD_HASH")
+	serveCmd.AddCommand(hashPasswordCmd)
+	serveCmd.Flags().StringSliceVar(&corsOrigins, "cors-origin", nil, "Origin allowed to call the UI API from a browser, e.g. http://localhost:5173, may be repeated (\"*\" for any)")
 }
 
 func runServe(cmd *cobra.Command, args []string) {
-	uiAddress := fmt.Sprintf("localhost:%d", uiPort)
-	
+	uiAddress := fmt.Sprintf("%s:%d", uiHost, uiPort)
+
 	logger.Printf("🚀 Starting ChessHook UI...\n")
 	logger.Printf("📊 Web UI: http://%s\n", uiAddress)
 	logger.Printf("🎮 Engine Server: ws://localhost:%d/ws\n", enginePort)
 	logger.Printf("\n")
 	logger.Printf("Open your browser and navigate to http://%s\n", uiAddress)
-	
+
+	if rotatePasskey {
+		passKey, err := generatePasskey()
+		if err != nil {
+			log.Fatalf("Failed to rotate passkey: %v", err)
+		}
+		if err := savePasskey(enginePasskeyPath, passKey); err != nil {
+			log.Fatalf("Failed to save passkey: %v", err)
+		}
+		logger.Printf("🔑 Engine passkey rotated, update your userscript.\n")
+	}
+
 	uiServer := NewUIServer(uiAddress)
-	
+	uiServer.SetAllowedOrigins(corsOrigins)
+	if authPassHash == "" {
+		authPassHash = os.Getenv("CHESSHOOK_UI_PASSWORD_HASH")
+	}
+	uiServer.SetAuth(authUser, authPassHash)
+	uiServer.SetEngineAddress(fmt.Sprintf("localhost:%d", enginePort))
+
+	if withEngine {
+		passKey, err := uiServer.StartEngineServer()
+		if err != nil {
+			log.Fatalf("Failed to start engine server: %v", err)
+		}
+		logger.Printf("🎮 Engine server started on ws://localhost:%d/ws\n", enginePort)
+		logger.Printf("🔑 Engine passkey: %s\n", passKey)
+	}
+
+	// Stop the running job on Ctrl+C so it still saves db.json and unlocks it
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+		logger.Printf("Shutting down, waiting for the running job to save...\n")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := uiServer.Shutdown(shutdownCtx); err != nil {
+			logger.Errorf("UI server shutdown: %v\n", err)
+		}
+	}()
+
 	if err := uiServer.Start(); err != nil {
 		log.Fatalf("Failed to start UI server: %v", err)
 	}
 }
+
+func runHashPassword(cmd *cobra.Command, args []string) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		if err != nil {
+			log.Fatalf("No password given: %v", err)
+		}
+		log.Fatalf("The password can't be empty.")
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+	fmt.Println(hash)
+}
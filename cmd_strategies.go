@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var strategiesCmd = &cobra.Command{
+	Use:   "strategies",
+	Short: "Inspect the strategies in strategies.json",
+}
+
+var listStrategiesCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the strategies in strategies.json",
+	Long:  "Prints each strategy's stop mode, target, time mode and submit mode, and how many accounts use it.",
+	Args:  cobra.NoArgs,
+	Run:   listStrategies,
+}
+
+var validateStrategiesCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check strategies.json for problems",
+	Long:  "Runs the same checks as `run` on every strategy in strategies.json and reports accounts in db.json that use a strategy that doesn't exist. Exits with status 1 when anything is wrong.",
+	Args:  cobra.NoArgs,
+	Run:   validateStrategies,
+}
+
+var addStrategyCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a strategy to strategies.json, or change one with --edit",
+	Long:  "Adds a strategy to strategies.json, prompting for every setting not given as a flag. With --edit the named strategy is updated instead, keeping its current values for anything left blank. Other strategies are left untouched.",
+	Args:  cobra.ExactArgs(1),
+	Run:   addStrategy,
+}
+
+var (
+	strategyEdit          bool
+	strategyStopMode      string
+	strategyPuzzlesPerDay int
+	strategyTargetRating  int
+	strategyTimeMode      string
+	strategySubmitMode    string
+)
+
+func init() {
+	strategiesCmd.AddCommand(listStrategiesCmd)
+	strategiesCmd.AddCommand(validateStrategiesCmd)
+	strategiesCmd.AddCommand(addStrategyCmd)
+
+	addStrategyCmd.Flags().BoolVar(&strategyEdit, "edit", false, "Update an existing strategy instead of adding a new one")
+	addStrategyCmd.Flags().StringVar(&strategyStopMode, "stop-mode", "", "stop_at_puzzles_completed, stop_at_rating, stop_at_rating_floor or keep_streak")
+	addStrategyCmd.Flags().IntVar(&strategyPuzzlesPerDay, "puzzles-per-day", 0, "Puzzles to solve each day, for the puzzles and streak stop modes")
+	addStrategyCmd.Flags().IntVar(&strategyTargetRating, "target-rating", 0, "Rating to stop at, for the rating stop modes")
+	addStrategyCmd.Flags().StringVar(&strategyTimeMode, "time-mode", "", "legit, hour, zero or realistic")
+	addStrategyCmd.Flags().StringVar(&strategySubmitMode, "submit-mode", "", "asap or legit")
+}
+
+// strategyTarget describes what a strategy stops at
+func strategyTarget(s Strategy) string {
+	switch s.StopMode {
+	case StopModePuzzles:
+		return fmt.Sprintf("%d puzzles/day", s.PuzzlesPerDay)
+	case StopModeRating:
+		return fmt.Sprintf("rating %d", s.TargetRating)
+	case StopModeRatingFloor:
+		return fmt.Sprintf("rating floor %d", s.TargetRating)
+	case StopModeStreak:
+		if s.PuzzlesPerDay > 0 {
+			return fmt.Sprintf("streak, %d puzzles", s.PuzzlesPerDay)
+		}
+		return "streak"
+	default:
+		return "-"
+	}
+}
+
+// strategyUsers counts the accounts in db.json using each strategy name
+func strategyUsers(db *Database) map[string]int {
+	users := make(map[string]int)
+	for _, account := range db.Accounts {
+		users[account.StrategyName]++
+	}
+	return users
+}
+
+func listStrategies(cmd *cobra.Command, args []string) {
+	strategies, err := loadStrategies(strategiesPath)
+	if err != nil {
+		log.Fatalf("Failed to load strategies, run `strategies validate` for details: %v", err)
+	}
+	db, err := readDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to load database: %v", err)
+	}
+	users := strategyUsers(db)
+
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var table strings.Builder
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tSTOP MODE\tTARGET\tTIME MODE\tSUBMIT MODE\tACCOUNTS")
+	for _, name := range names {
+		s := strategies[name]
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%d\n", s.Name, s.StopMode, strategyTarget(s), s.TimeMode, s.SubmitMode, users[name])
+	}
+	writer.Flush()
+	logger.Printf("%s", table.String())
+}
+
+func validateStrategies(cmd *cobra.Command, args []string) {
+	strategies, err := loadStrategies(strategiesPath)
+	if err != nil {
+		logger.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	logger.Printf("✅ %d strategies in strategies.json are valid.\n", len(strategies))
+
+	db, err := readDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to load database: %v", err)
+	}
+	var missing []string
+	for _, account := range db.Accounts {
+		if _, ok := strategies[account.StrategyName]; !ok {
+			missing = append(missing, fmt.Sprintf("%s uses unknown strategy '%s'", account.Username, account.StrategyName))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		logger.Printf("❌ Accounts with a strategy that doesn't exist:\n- %s\n", strings.Join(missing, "\n- "))
+		os.Exit(1)
+	}
+}
+
+// strategyPrompter asks for the strategy settings that weren't given as flags
+type strategyPrompter struct {
+	cmd    *cobra.Command
+	reader *bufio.Reader
+}
+
+// ask returns the flag's value when it was set, otherwise prompts for it, keeping current on an empty answer
+func (p *strategyPrompter) ask(flag, label, current string) string {
+	if p.cmd.Flags().Changed(flag) {
+		return p.cmd.Flags().Lookup(flag).Value.String()
+	}
+	if current != "" {
+		logger.Printf("%s [%s]: ", label, current)
+	} else {
+		logger.Printf("%s: ", label)
+	}
+	answer, err := p.reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" && err != nil {
+		log.Fatalf("No value given for --%s.", flag)
+	}
+	if answer == "" {
+		return current
+	}
+	return answer
+}
+
+// askInt is ask for a number, asking again until the answer is one
+func (p *strategyPrompter) askInt(flag, label string, current int) int {
+	for {
+		answer := p.ask(flag, label, strconv.Itoa(current))
+		n, err := strconv.Atoi(answer)
+		if err == nil {
+			return n
+		}
+		if p.cmd.Flags().Changed(flag) {
+			log.Fatalf("Invalid value for --%s: %v", flag, err)
+		}
+		logger.Printf("'%s' is not a number.\n", answer)
+	}
+}
+
+func addStrategy(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	config, err := readStrategiesConfig(strategiesPath)
+	if err != nil {
+		log.Fatalf("Failed to load strategies: %v", err)
+	}
+
+	index := -1
+	for i, s := range config.Strategies {
+		if s.Name == name {
+			index = i
+			break
+		}
+	}
+	switch {
+	case strategyEdit && index < 0:
+		log.Fatalf("Strategy '%s' not found in strategies.json.", name)
+	case !strategyEdit && index >= 0:
+		log.Fatalf("Strategy '%s' already exists, use --edit to change it.", name)
+	}
+
+	strategy := Strategy{Name: name, StopMode: StopModePuzzles, PuzzlesPerDay: 3, TimeMode: TimeModeLegit, SubmitMode: SubmitModeLegit}
+	if index >= 0 {
+		strategy = config.Strategies[index]
+	}
+
+	prompter := &strategyPrompter{cmd: cmd, reader: bufio.NewReader(os.Stdin)}
+	strategy.StopMode = StopModeType(prompter.ask("stop-mode", "Stop mode (stop_at_puzzles_completed, stop_at_rating, stop_at_rating_floor, keep_streak)", string(strategy.StopMode)))
+	switch strategy.StopMode {
+	case StopModePuzzles, StopModeStreak:
+		strategy.PuzzlesPerDay = prompter.askInt("puzzles-per-day", "Puzzles per day", strategy.PuzzlesPerDay)
+	case StopModeRating, StopModeRatingFloor:
+		strategy.TargetRating = prompter.askInt("target-rating", "Target rating", strategy.TargetRating)
+	}
+	strategy.TimeMode = TimeModeType(prompter.ask("time-mode", "Time mode (legit, hour, zero, realistic)", string(strategy.TimeMode)))
+	strategy.SubmitMode = SubmitModeType(prompter.ask("submit-mode", "Submit mode (asap, legit)", string(strategy.SubmitMode)))
+
+	if err := validateStrategy(strategy); err != nil {
+		log.Fatalf("Invalid strategy '%s':\n%v", name, err)
+	}
+
+	if err := saveStrategy(strategiesPath, index, strategy); err != nil {
+		log.Fatalf("Failed to save strategies: %v", err)
+	}
+
+	if index >= 0 {
+		logger.Printf("Updated strategy '%s' (%s, %s).\n", name, strategy.StopMode, strategyTarget(strategy))
+	} else {
+		logger.Printf("Added strategy '%s' (%s, %s).\n", name, strategy.StopMode, strategyTarget(strategy))
+	}
+}
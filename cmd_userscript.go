@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
 	"text/template"
 
@@ -24,23 +26,29 @@ var generateUserscriptCmd = &cobra.Command{
 }
 
 var (
-	engineType     string
-	autoMove       bool
-	arrowColor     string
-	wsURL          string
-	wsPassKey      string
-	outputFile     string
+	engineType    string
+	autoMove      bool
+	arrowColor    string
+	wsURL         string
+	wsPassKey     string
+	outputFile    string
+	toStdout      bool
+	scriptDepth   int
+	scriptMultiPV int
 )
 
 func init() {
 	userscriptCmd.AddCommand(generateUserscriptCmd)
-	
+
 	generateUserscriptCmd.Flags().StringVar(&engineType, "engine", "betafish", "Engine type: betafish, external, random")
 	generateUserscriptCmd.Flags().BoolVar(&autoMove, "auto-move", false, "Automatically play moves")
 	generateUserscriptCmd.Flags().StringVar(&arrowColor, "arrow-color", "#77ff77", "Color for move arrows (hex)")
 	generateUserscriptCmd.Flags().StringVar(&wsURL, "ws-url", "ws://localhost:8080/ws", "WebSocket URL for external engine")
 	generateUserscriptCmd.Flags().StringVar(&wsPassKey, "passkey", "", "Passkey for external engine authentication")
 	generateUserscriptCmd.Flags().StringVar(&outputFile, "output", "chesshook.user.js", "Output file path")
+	generateUserscriptCmd.Flags().IntVar(&scriptDepth, "depth", 20, "Search depth the userscript requests from the engine")
+	generateUserscriptCmd.Flags().IntVar(&scriptMultiPV, "multipv", 3, "Number of principal variations the engine is configured for")
+	generateUserscriptCmd.Flags().BoolVar(&toStdout, "stdout", false, "Write the userscript to stdout instead of a file")
 }
 
 type UserscriptConfig struct {
@@ -49,17 +57,82 @@ type UserscriptConfig struct {
 	ArrowColor        string
 	ExternalEngineURL string
 	PassKey           string
+	Depth             int
+	MultiPV           int
+}
+
+// cssColorNames maps the common CSS color names accepted for --arrow-color to hex
+var cssColorNames = map[string]string{
+	"black":   "#000000",
+	"white":   "#ffffff",
+	"red":     "#ff0000",
+	"green":   "#008000",
+	"lime":    "#00ff00",
+	"blue":    "#0000ff",
+	"yellow":  "#ffff00",
+	"cyan":    "#00ffff",
+	"aqua":    "#00ffff",
+	"magenta": "#ff00ff",
+	"fuchsia": "#ff00ff",
+	"orange":  "#ffa500",
+	"purple":  "#800080",
+	"pink":    "#ffc0cb",
+	"gray":    "#808080",
+	"grey":    "#808080",
+	"silver":  "#c0c0c0",
+	"maroon":  "#800000",
+	"navy":    "#000080",
+	"teal":    "#008080",
+	"olive":   "#808000",
+	"gold":    "#ffd700",
+	"brown":   "#a52a2a",
+}
+
+var hexColorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// normalizeArrowColor validates a #RGB, #RRGGBB or CSS color name and returns it as lowercase #rrggbb
+func normalizeArrowColor(color string) (string, error) {
+	color = strings.TrimSpace(color)
+	if hex, ok := cssColorNames[strings.ToLower(color)]; ok {
+		return hex, nil
+	}
+	if !hexColorPattern.MatchString(color) {
+		return "", fmt.Errorf("invalid arrow color %q: expected #RGB, #RRGGBB or a CSS color name", color)
+	}
+	color = strings.ToLower(color)
+	if len(color) == 4 {
+		color = "#" + strings.Repeat(color[1:2], 2) + strings.Repeat(color[2:3], 2) + strings.Repeat(color[3:4], 2)
+	}
+	return color, nil
 }
 
 func runGenerateUserscript(cmd *cobra.Command, args []string) {
-	logger.Printf("Generating userscript with engine: %s\n", engineType)
+	// With --stdout the script itself goes to stdout, so informational output moves to stderr
+	info := logger.Printf
+	if toStdout {
+		info = func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format, args...)
+		}
+	}
+
+	normalizedColor, err := normalizeArrowColor(arrowColor)
+	if err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+	arrowColor = normalizedColor
+
+	if scriptDepth <= 0 || scriptMultiPV <= 0 {
+		log.Fatalf("Error: --depth and --multipv must be positive\n")
+	}
+
+	info("Generating userscript with engine: %s\n", engineType)
 
 	// Read template
 	templatePath := "userscript/template.user.js"
 	templateContent, err := os.ReadFile(templatePath)
 	if err != nil {
-		logger.Printf("Warning: Could not read template file %s: %v\n", templatePath, err)
-		logger.Printf("Using embedded fallback template...\n")
+		info("Warning: Could not read template file %s: %v\n", templatePath, err)
+		info("Using embedded fallback template...\n")
 		// Use embedded template if file doesn't exist
 		templateContent = []byte(getDefaultUserscriptTemplate())
 	}
@@ -75,32 +148,41 @@ func runGenerateUserscript(cmd *cobra.Command, args []string) {
 		ArrowColor:        arrowColor,
 		ExternalEngineURL: wsURL,
 		PassKey:           wsPassKey,
+		Depth:             scriptDepth,
+		MultiPV:           scriptMultiPV,
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputFile)
-	if err != nil {
-		log.Fatalf("Error creating output file: %v\n", err)
+	// Execute template into memory first so a failure never leaves a partial script behind
+	var script bytes.Buffer
+	if err := tmpl.Execute(&script, config); err != nil {
+		log.Fatalf("Error executing template: %v\n", err)
 	}
-	defer outFile.Close()
 
-	// Execute template
-	if err := tmpl.Execute(outFile, config); err != nil {
-		log.Fatalf("Error executing template: %v\n", err)
+	if toStdout {
+		if _, err := os.Stdout.Write(script.Bytes()); err != nil {
+			log.Fatalf("Error writing userscript: %v\n", err)
+		}
+		info("✓ Userscript written to stdout\n")
+		return
+	}
+
+	if err := os.WriteFile(outputFile, script.Bytes(), 0644); err != nil {
+		log.Fatalf("Error creating output file: %v\n", err)
 	}
 
-	logger.Printf("✓ Userscript generated successfully: %s\n", outputFile)
-	logger.Printf("  Engine: %s\n", engineType)
-	logger.Printf("  Auto-move: %t\n", autoMove)
-	logger.Printf("  Arrow color: %s\n", arrowColor)
+	info("✓ Userscript generated successfully: %s\n", outputFile)
+	info("  Engine: %s\n", engineType)
+	info("  Auto-move: %t\n", autoMove)
+	info("  Arrow color: %s\n", arrowColor)
+	info("  Depth: %d, MultiPV: %d\n", scriptDepth, scriptMultiPV)
 	if engineType == "external" {
-		logger.Printf("  WebSocket URL: %s\n", wsURL)
+		info("  WebSocket URL: %s\n", wsURL)
 	}
-	logger.Printf("\nInstallation:\n")
-	logger.Printf("1. Install Tampermonkey or Greasemonkey in your browser\n")
-	logger.Printf("2. Click on the extension icon and select 'Create new script'\n")
-	logger.Printf("3. Copy the contents of %s into the editor\n", outputFile)
-	logger.Printf("4. Save and navigate to chess.com\n")
+	info("\nInstallation:\n")
+	info("1. Install Tampermonkey or Greasemonkey in your browser\n")
+	info("2. Click on the extension icon and select 'Create new script'\n")
+	info("3. Copy the contents of %s into the editor\n", outputFile)
+	info("4. Save and navigate to chess.com\n")
 }
 
 func getDefaultUserscriptTemplate() string {
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestNormalizeArrowColor(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "#ff8800", want: "#ff8800"},
+		{input: "#FF8800", want: "#ff8800"},
+		{input: "#abc", want: "#aabbcc"},
+		{input: "#ABC", want: "#aabbcc"},
+		{input: " #00ff00 ", want: "#00ff00"},
+		{input: "red", want: "#ff0000"},
+		{input: "Blue", want: "#0000ff"},
+		{input: "GREY", want: "#808080"},
+		{input: "", wantErr: true},
+		{input: "#gggggg", wantErr: true},
+		{input: "#12345", wantErr: true},
+		{input: "#1234567", wantErr: true},
+		{input: "ff0000", wantErr: true},
+		{input: "#ff0000\n", want: "#ff0000"},
+		{input: "#ff0000;", wantErr: true},
+		{input: `#fff";alert(1);//`, wantErr: true},
+		{input: "rgb(255, 0, 0)", wantErr: true},
+		{input: "rebeccapurple", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := normalizeArrowColor(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("normalizeArrowColor(%q) = %q, want an error", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeArrowColor(%q) error: %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeArrowColor(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
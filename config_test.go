@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func validTestStrategy() Strategy {
+	return Strategy{
+		Name:          "default",
+		StopMode:      StopModePuzzles,
+		PuzzlesPerDay: 10,
+		TimeMode:      TimeModeLegit,
+		SubmitMode:    SubmitModeASAP,
+	}
+}
+
+func TestValidateStrategy(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(s *Strategy)
+		wantErr string // Substring of the error, "" for a valid strategy
+	}{
+		{name: "valid", modify: func(s *Strategy) {}},
+		{name: "valid rating", modify: func(s *Strategy) { s.StopMode, s.PuzzlesPerDay, s.TargetRating = StopModeRating, 0, 1500 }},
+		{name: "valid streak without puzzles", modify: func(s *Strategy) { s.StopMode, s.PuzzlesPerDay = StopModeStreak, 0 }},
+		{name: "empty name", modify: func(s *Strategy) { s.Name = "" }, wantErr: "name must not be empty"},
+		{name: "unknown stop mode", modify: func(s *Strategy) { s.StopMode = "stop_eventually" }, wantErr: "unknown stop_mode"},
+		{name: "puzzles mode without puzzles", modify: func(s *Strategy) { s.PuzzlesPerDay = 0 }, wantErr: "puzzles_per_day must be positive"},
+		{name: "rating mode without target", modify: func(s *Strategy) { s.StopMode = StopModeRating }, wantErr: "target_rating must be positive"},
+		{name: "rating floor without target", modify: func(s *Strategy) { s.StopMode, s.TargetRating = StopModeRatingFloor, -5 }, wantErr: "target_rating must be positive"},
+		{name: "streak with negative puzzles", modify: func(s *Strategy) { s.StopMode, s.PuzzlesPerDay = StopModeStreak, -1 }, wantErr: "puzzles_per_day must not be negative"},
+		{name: "unknown time mode", modify: func(s *Strategy) { s.TimeMode = "Legit" }, wantErr: "unknown time_mode"},
+		{name: "unknown submit mode", modify: func(s *Strategy) { s.SubmitMode = "slow" }, wantErr: "unknown submit_mode"},
+		{name: "negative delay", modify: func(s *Strategy) { s.MinDelayMs = -1 }, wantErr: "must not be negative"},
+		{name: "min delay above max", modify: func(s *Strategy) { s.MinDelayMs, s.MaxDelayMs = 500, 100 }, wantErr: "must not be greater than"},
+		{name: "min delay without max", modify: func(s *Strategy) { s.MinDelayMs = 100 }, wantErr: "max_delay_ms isn't"},
+		{name: "daily target skip in rating mode", modify: func(s *Strategy) { s.StopMode, s.TargetRating, s.SkipWhenDailyTargetMet = StopModeRating, 1500, true }, wantErr: "skip_when_daily_target_met"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy := validTestStrategy()
+			tt.modify(&strategy)
+			err := validateStrategy(strategy)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateStrategy() error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateStrategy() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateStrategyReportsAllProblems(t *testing.T) {
+	err := validateStrategy(Strategy{Name: "broken", StopMode: StopModeRating, TimeMode: "fast", SubmitMode: "never"})
+	if err == nil {
+		t.Fatal("validateStrategy() returned no error")
+	}
+	for _, want := range []string{"target_rating", "time_mode", "submit_mode"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("validateStrategy() error %q doesn't mention %s", err, want)
+		}
+	}
+}
+
+func TestLoadStrategiesReportsAllInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strategies.json")
+	content := `{"strategies": [
+		{"name": "good", "stop_mode": "stop_at_puzzles_completed", "puzzles_per_day": 5, "time_mode": "legit", "submit_mode": "asap"},
+		{"name": "no_target", "stop_mode": "stop_at_rating", "target_rating": 0, "time_mode": "legit", "submit_mode": "asap"},
+		{"name": "typo", "stop_mode": "stop_at_puzzles_completed", "puzzles_per_day": 5, "time_mode": "Legit", "submit_mode": "asap"},
+		{"name": "good", "stop_mode": "stop_at_puzzles_completed", "puzzles_per_day": 5, "time_mode": "legit", "submit_mode": "asap"}
+	]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	strategies, err := loadStrategies(path)
+	if err == nil {
+		t.Fatalf("loadStrategies() = %v, want an error", strategies)
+	}
+	for _, want := range []string{`#2 ("no_target")`, `#3 ("typo")`, `#4 ("good"): duplicate strategy name`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("loadStrategies() error %q doesn't mention %s", err, want)
+		}
+	}
+}
+
+func TestSaveStrategyKeepsTheFileAsWritten(t *testing.T) {
+	const original = `{
+    "comment": "kept by hand",
+    "strategies": [
+        {
+            "name": "default",
+            "stop_mode": "stop_at_puzzles_completed",
+            "puzzles_per_day": 3,
+            "time_mode": "legit",
+            "submit_mode": "legit",
+            "notes": "a key this version doesn't know"
+        }
+    ]
+}
+`
+	added := Strategy{Name: "fast", StopMode: StopModePuzzles, PuzzlesPerDay: 5, TimeMode: TimeModeZero, SubmitMode: SubmitModeASAP}
+
+	path := filepath.Join(t.TempDir(), "strategies.json")
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveStrategy(path, -1, added); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(original, `
+        }
+    ]`, `
+        },
+        {
+            "name": "fast",
+            "stop_mode": "stop_at_puzzles_completed",
+            "puzzles_per_day": 5,
+            "target_rating": 0,
+            "time_mode": "zero",
+            "submit_mode": "asap"
+        }
+    ]`, 1)
+	if string(got) != want {
+		t.Fatalf("after adding a strategy:\n%s\nwant\n%s", got, want)
+	}
+
+	added.PuzzlesPerDay = 8
+	if err := saveStrategy(path, 1, added); err != nil {
+		t.Fatal(err)
+	}
+	got, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Replace(want, `"puzzles_per_day": 5`, `"puzzles_per_day": 8`, 1)
+	if string(got) != want {
+		t.Fatalf("after editing the strategy:\n%s\nwant\n%s", got, want)
+	}
+}
+
+// copyTestDatabase copies a database fixture from testdata to a temporary db.json
+func copyTestDatabase(t *testing.T, fixture string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "db.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unlockDatabase(path) })
+	return path
+}
+
+func TestLoadDatabaseMigratesV0(t *testing.T) {
+	const aliceID = "3f2b8c1e-6a4d-11ee-9f1a-0242ac120002"
+	path := copyTestDatabase(t, "db_v0.json")
+
+	db, err := loadDatabase(path)
+	if err != nil {
+		t.Fatalf("loadDatabase error: %v", err)
+	}
+	if db.SchemaVersion != databaseSchemaVersion {
+		t.Errorf("schema version = %d, want %d", db.SchemaVersion, databaseSchemaVersion)
+	}
+
+	// An account with an ID is re-keyed by it
+	if _, ok := db.Accounts["alice"]; ok {
+		t.Error("alice is still keyed by username")
+	}
+	alice, ok := db.Accounts[aliceID]
+	if !ok {
+		t.Fatal("alice isn't keyed by its ID")
+	}
+	if alice.NeedsMigration || alice.LastRating != 1850 {
+		t.Errorf("alice = %+v, want the data unchanged and not flagged", alice)
+	}
+
+	// One without an ID keeps its username key and is flagged until it gets one
+	bob, ok := db.Accounts["bob"]
+	if !ok {
+		t.Fatal("bob is no longer keyed by username")
+	}
+	if !bob.NeedsMigration {
+		t.Error("bob isn't flagged as needing migration")
+	}
+
+	// The migration is saved, with the original kept as a backup
+	saved, err := readDatabase(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.SchemaVersion != databaseSchemaVersion || !saved.Accounts["bob"].NeedsMigration {
+		t.Errorf("saved database = %+v, want the migrated one", saved)
+	}
+	backups, err := listDatabaseBackups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("got %d backups, want 1", len(backups))
+	}
+	backup, err := os.ReadFile(backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(backup), "schema_version") {
+		t.Error("the backup isn't the pre-migration file")
+	}
+}
+
+func TestFlaggedAccountMigratesOnceItHasAnID(t *testing.T) {
+	path := copyTestDatabase(t, "db_v0.json")
+	db, err := loadDatabase(path)
+	if err != nil {
+		t.Fatalf("loadDatabase error: %v", err)
+	}
+	if pending := db.unmigratedAccounts(); pending != 1 {
+		t.Fatalf("%d accounts need migration, want 1", pending)
+	}
+
+	// What refreshAccount does once it has fetched the profile
+	bob := db.Accounts["bob"]
+	bob.ID = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	db.PutAccount("bob", bob)
+
+	if _, ok := db.Accounts["bob"]; ok {
+		t.Error("bob is still keyed by username")
+	}
+	if db.Accounts[bob.ID].NeedsMigration {
+		t.Error("bob is still flagged after getting an ID")
+	}
+	if pending := db.unmigratedAccounts(); pending != 0 {
+		t.Errorf("%d accounts need migration, want 0", pending)
+	}
+}
+
+func TestLoadDatabaseRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	t.Cleanup(func() { unlockDatabase(path) })
+	data := fmt.Sprintf(`{"schema_version": %d, "accounts": {}}`, databaseSchemaVersion+1)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadDatabase(path); err == nil {
+		t.Fatal("loadDatabase of a newer schema succeeded, want an error")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// dbBackupsKept is how many backups of the database saveDatabase keeps around
+	dbBackupsKept = 5
+	// dbBackupTimeFormat sorts the same as the backup times, so the newest backup sorts last
+	dbBackupTimeFormat = "20060102-150405.000"
+)
+
+var restoreAccountsCmd = &cobra.Command{
+	Use:   "restore [backup]",
+	Short: "Restore db.json from a backup",
+	Long:  "Lists the backups saveDatabase keeps of db.json, newest first. Given a backup's number from the list (or its path), restores it; the current db.json is backed up first so the restore can be undone.",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   restoreAccounts,
+}
+
+// backupDatabase copies the current database file to a timestamped backup before it is replaced with
+// data, and removes backups beyond dbBackupsKept. Nothing is backed up when the content is unchanged
+func backupDatabase(path string, data []byte) error {
+	current, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, data) {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().Format(dbBackupTimeFormat))
+	if err := writeFileAtomic(backupPath, current, 0644); err != nil {
+		return err
+	}
+
+	backups, err := listDatabaseBackups(path)
+	if err != nil {
+		return err
+	}
+	for _, old := range backups[min(len(backups), dbBackupsKept):] {
+		os.Remove(old)
+	}
+	return nil
+}
+
+// listDatabaseBackups returns the backups of the database at path, newest first
+func listDatabaseBackups(path string) ([]string, error) {
+	backups, err := filepath.Glob(globEscape(path) + ".*.bak")
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+// globEscape escapes the glob metacharacters in a literal path
+func globEscape(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
+
+// backupTime reads the time a backup was taken from its name
+func backupTime(dbPath, backupPath string) (time.Time, bool) {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(backupPath, dbPath+"."), ".bak")
+	t, err := time.ParseInLocation(dbBackupTimeFormat, stamp, time.Local)
+	return t, err == nil
+}
+
+func restoreAccounts(cmd *cobra.Command, args []string) {
+	backups, err := listDatabaseBackups(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to list backups: %v", err)
+	}
+
+	if len(args) == 0 {
+		if len(backups) == 0 {
+			logger.Println("No backups of db.json found.")
+			return
+		}
+		var table strings.Builder
+		writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "#\tTAKEN\tACCOUNTS\tFILE")
+		for i, backup := range backups {
+			taken := "-"
+			if t, ok := backupTime(dbPath, backup); ok {
+				taken = t.Format("2006-01-02 15:04:05")
+			}
+			accounts := "unreadable"
+			if data, err := os.ReadFile(backup); err == nil {
+				if db, err := parseDatabase(data); err == nil {
+					accounts = strconv.Itoa(len(db.Accounts))
+				}
+			}
+			fmt.Fprintf(writer, "%d\t%s\t%s\t%s\n", i+1, taken, accounts, backup)
+		}
+		writer.Flush()
+		logger.Printf("%s", table.String())
+		logger.Println("Run `accounts restore <#>` to restore one.")
+		return
+	}
+
+	backup := args[0]
+	if n, err := strconv.Atoi(args[0]); err == nil {
+		if n < 1 || n > len(backups) {
+			log.Fatalf("There is no backup #%d, there are %d.", n, len(backups))
+		}
+		backup = backups[n-1]
+	}
+
+	restored, err := restoreDatabaseBackup(dbPath, backup)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	logger.Printf("Restored db.json from %s (%d accounts).\n", backup, len(restored.Accounts))
+}
+
+// restoreDatabaseBackup replaces the database at path with the backup file, after checking that
+// it is a database this version can read. saveDatabase backs up the current file first, so the
+// restore itself can be undone
+func restoreDatabaseBackup(path, backup string) (*Database, error) {
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	restored, err := parseDatabase(data)
+	if err != nil {
+		return nil, fmt.Errorf("backup %s is not a valid database: %w", backup, err)
+	}
+	if _, err := upgradeDatabase(restored); err != nil {
+		return nil, fmt.Errorf("cannot restore %s: %w", backup, err)
+	}
+
+	if err := lockDatabase(path); err != nil {
+		return nil, fmt.Errorf("failed to lock database: %w", err)
+	}
+	if err := saveDatabase(path, restored); err != nil {
+		return nil, fmt.Errorf("failed to save database: %w", err)
+	}
+	return restored, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// dbLockWait is how long loadDatabase waits for another process to let go of the database
+const dbLockWait = 10 * time.Second
+
+// ErrDatabaseInUse is returned by loadDatabase when another process keeps the database locked
+var ErrDatabaseInUse = errors.New("database is in use")
+
+// errLocked is returned by tryLockFile when another process holds the lock
+var errLocked = errors.New("lock is held")
+
+var (
+	dbLocks   = make(map[string]*os.File)
+	dbLocksMu sync.Mutex
+)
+
+// lockDatabase takes an advisory lock on the database through a .lock file next to it, so two
+// commands can't both load, change and save it. The lock is held until unlockDatabase or the
+// process exits, taking it again from the same process does nothing
+func lockDatabase(path string) error {
+	dbLocksMu.Lock()
+	defer dbLocksMu.Unlock()
+	if _, ok := dbLocks[path]; ok {
+		return nil
+	}
+
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(dbLockWait)
+	waiting := false
+	for {
+		file, err := tryLockFile(lockPath)
+		if err == nil {
+			file.Truncate(0)
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			dbLocks[path] = file
+			return nil
+		}
+		if !errors.Is(err, errLocked) {
+			return fmt.Errorf("failed to lock database: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w by another chesshook2 process (%s%s)", ErrDatabaseInUse, lockPath, staleLockHint)
+		}
+		if !waiting {
+			logger.Warnf("Database is in use by another process, waiting up to %s...\n", dbLockWait)
+			waiting = true
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// unlockDatabase releases the lock taken by lockDatabase, if this process holds it
+func unlockDatabase(path string) {
+	dbLocksMu.Lock()
+	defer dbLocksMu.Unlock()
+	if file, ok := dbLocks[path]; ok {
+		unlockFile(file)
+		delete(dbLocks, path)
+	}
+}
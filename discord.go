@@ -3,8 +3,14 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
 type WebhookPayload struct {
@@ -39,45 +45,302 @@ type EmbedAuthor struct {
 	IconURL string `json:"icon_url,omitempty"`
 }
 
+// Discord's documented embed limits, counted in characters
+const (
+	embedTitleLimit       = 256
+	embedDescriptionLimit = 4096
+	embedFieldNameLimit   = 256
+	embedFieldValueLimit  = 1024
+	embedFieldCountLimit  = 25
+	embedTotalLimit       = 6000
+	embedsPerMessageLimit = 10
+)
+
+// truncateRunes shortens s to at most limit characters, marking the cut with an ellipsis
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
+
+// splitEmbedField splits a field whose value exceeds the value limit into several fields,
+// breaking on newlines where possible
+func splitEmbedField(field EmbedField) []EmbedField {
+	field.Name = truncateRunes(field.Name, embedFieldNameLimit)
+	if field.Value == "" {
+		field.Value = "\u200b" // Discord rejects empty field values
+	}
+	if utf8.RuneCountInString(field.Value) <= embedFieldValueLimit {
+		return []EmbedField{field}
+	}
+
+	var fields []EmbedField
+	var current strings.Builder
+	flush := func() {
+		name := field.Name
+		if len(fields) > 0 {
+			name = truncateRunes(field.Name+" (cont.)", embedFieldNameLimit)
+		}
+		fields = append(fields, EmbedField{Name: name, Value: current.String(), Inline: field.Inline})
+		current.Reset()
+	}
+	for _, line := range strings.Split(field.Value, "\n") {
+		line = truncateRunes(line, embedFieldValueLimit)
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+1+utf8.RuneCountInString(line) > embedFieldValueLimit {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		flush()
+	}
+	return fields
+}
+
+func embedSize(embed Embed) int {
+	size := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	if embed.Footer != nil {
+		size += utf8.RuneCountInString(embed.Footer.Text)
+	}
+	if embed.Author != nil {
+		size += utf8.RuneCountInString(embed.Author.Name)
+	}
+	for _, field := range embed.Fields {
+		size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	return size
+}
+
+// fitEmbed enforces Discord's per-field, per-embed and total size limits, spilling fields
+// that don't fit into continuation embeds
+func fitEmbed(embed Embed) []Embed {
+	embed.Title = truncateRunes(embed.Title, embedTitleLimit)
+	embed.Description = truncateRunes(embed.Description, embedDescriptionLimit)
+
+	var fields []EmbedField
+	for _, field := range embed.Fields {
+		fields = append(fields, splitEmbedField(field)...)
+	}
+
+	first := embed
+	first.Fields = nil
+	embeds := []Embed{first}
+	for _, field := range fields {
+		last := &embeds[len(embeds)-1]
+		fieldSize := utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		if len(last.Fields) >= embedFieldCountLimit || embedSize(*last)+fieldSize > embedTotalLimit {
+			embeds = append(embeds, Embed{
+				Title:     truncateRunes(embed.Title+" (cont.)", embedTitleLimit),
+				Color:     embed.Color,
+				Timestamp: embed.Timestamp,
+			})
+			last = &embeds[len(embeds)-1]
+		}
+		last.Fields = append(last.Fields, field)
+	}
+
+	return embeds
+}
+
+// fitEmbeds applies fitEmbed to every embed
+func fitEmbeds(embeds ...Embed) []Embed {
+	var fitted []Embed
+	for _, embed := range embeds {
+		fitted = append(fitted, fitEmbed(embed)...)
+	}
+	return fitted
+}
+
+// splitPayload splits a payload into messages of at most 10 embeds whose combined size stays
+// within Discord's total limit
+func splitPayload(payload WebhookPayload) []WebhookPayload {
+	if len(payload.Embeds) == 0 {
+		return []WebhookPayload{payload}
+	}
+
+	payloads := []WebhookPayload{{Content: payload.Content}}
+	size := 0
+	for _, embed := range payload.Embeds {
+		last := &payloads[len(payloads)-1]
+		if len(last.Embeds) >= embedsPerMessageLimit || (len(last.Embeds) > 0 && size+embedSize(embed) > embedTotalLimit) {
+			payloads = append(payloads, WebhookPayload{})
+			last = &payloads[len(payloads)-1]
+			size = 0
+		}
+		last.Embeds = append(last.Embeds, embed)
+		size += embedSize(embed)
+	}
+	return payloads
+}
+
 var webhookWarningSent = false
 
+const webhookMaxAttempts = 4
+
+var (
+	// webhookMu serializes sends so concurrent accounts queue up instead of tripping the rate limit
+	webhookMu sync.Mutex
+	// webhookNextAllowed is when the current rate limit bucket resets after it was exhausted
+	webhookNextAllowed time.Time
+)
+
+type discordRateLimitResponse struct {
+	Message    string  `json:"message"`
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
 func SendWebhook(url string, payload WebhookPayload) error {
-	if !strings.HasPrefix(url, "https://discord.com/api/webhooks/") {
+	if !isDiscordWebhookURL(url) {
 		if !webhookWarningSent {
-			logger.Printf("Discord webhook URL is not set correctly, skipping webhook send.\n")
+			logger.Debugf("Discord webhook URL is not set correctly, skipping webhook send.\n")
 			webhookWarningSent = true
 		}
 		return nil
 	}
 
-	payloadJSON, err := json.Marshal(payload)
+	for _, message := range splitPayload(payload) {
+		if err := sendWebhookMessage(url, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendWebhookMessage(url string, payload WebhookPayload) error {
+	_, err := doWebhookRequest("POST", url, payload)
+	return err
+}
+
+// isDiscordWebhookURL reports whether url looks like a Discord webhook
+func isDiscordWebhookURL(url string) bool {
+	return strings.HasPrefix(url, "https://discord.com/api/webhooks/")
+}
+
+type discordMessageResponse struct {
+	ID string `json:"id"`
+}
+
+// PostWebhookMessage sends a single message and returns its ID so it can be edited later
+func PostWebhookMessage(webhookURL string, payload WebhookPayload) (string, error) {
+	if !isDiscordWebhookURL(webhookURL) {
+		return "", fmt.Errorf("not a discord webhook URL")
+	}
+
+	body, err := doWebhookRequest("POST", webhookURLWithQuery(webhookURL, "wait=true"), payload)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payloadJSON))
+	var message discordMessageResponse
+	if err := json.Unmarshal(body, &message); err != nil || message.ID == "" {
+		return "", fmt.Errorf("discord did not return a message ID")
+	}
+	return message.ID, nil
+}
+
+// EditWebhookMessage replaces the content of a message previously sent through the webhook
+func EditWebhookMessage(webhookURL string, messageID string, payload WebhookPayload) error {
+	if !isDiscordWebhookURL(webhookURL) {
+		return fmt.Errorf("not a discord webhook URL")
+	}
+
+	base, query, _ := strings.Cut(webhookURL, "?")
+	editURL := base + "/messages/" + messageID
+	if query != "" {
+		editURL += "?" + query
+	}
+	_, err := doWebhookRequest("PATCH", editURL, payload)
+	return err
+}
+
+func webhookURLWithQuery(webhookURL, query string) string {
+	if strings.Contains(webhookURL, "?") {
+		return webhookURL + "&" + query
+	}
+	return webhookURL + "?" + query
+}
+
+// doWebhookRequest performs a webhook request, waiting out Discord's rate limits, and returns the response body
+func doWebhookRequest(method, url string, payload WebhookPayload) ([]byte, error) {
+	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
 	if logger != nil {
 		if len(payload.Embeds) > 0 {
-			logger.Printf("Sending discord webhook for: %s\n", payload.Embeds[0].Title)
+			logger.Debugf("Sending discord webhook for: %s\n", payload.Embeds[0].Title)
 		} else {
-			logger.Printf("Sending discord webhook...\n")
+			logger.Debugf("Sending discord webhook...\n")
 		}
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		if logger != nil {
-			logger.Printf("Error sending webhook: %v\n", err)
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	client := newHTTPClient(nil)
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if wait := time.Until(webhookNextAllowed); wait > 0 {
+			time.Sleep(wait)
 		}
-		return err
+
+		req, err := http.NewRequest(method, url, bytes.NewBuffer(payloadJSON))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			if logger != nil {
+				logger.Errorf("Error sending webhook: %v\n", err)
+			}
+			return nil, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			webhookNextAllowed = time.Now().Add(parseResetAfter(resp.Header))
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			retryAfter := parseResetAfter(resp.Header)
+			var rateLimit discordRateLimitResponse
+			if err := json.Unmarshal(body, &rateLimit); err == nil && rateLimit.RetryAfter > 0 {
+				retryAfter = time.Duration(rateLimit.RetryAfter * float64(time.Second))
+			}
+			if logger != nil {
+				logger.Warnf("Discord webhook rate limited, retrying in %s (attempt %d/%d)\n", retryAfter, attempt, webhookMaxAttempts)
+			}
+			webhookNextAllowed = time.Now().Add(retryAfter)
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			if logger != nil {
+				logger.Errorf("Discord webhook failed with %s: %s\n", resp.Status, string(body))
+			}
+			return nil, fmt.Errorf("discord webhook failed: %s", resp.Status)
+		}
+
+		return body, nil
 	}
-	defer resp.Body.Close()
 
-	return nil
+	return nil, fmt.Errorf("discord webhook still rate limited after %d attempts", webhookMaxAttempts)
+}
+
+// parseResetAfter reads Discord's X-RateLimit-Reset-After header, defaulting to one second
+func parseResetAfter(header http.Header) time.Duration {
+	seconds, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+	if err != nil || seconds <= 0 {
+		return time.Second
+	}
+	return time.Duration(seconds * float64(time.Second))
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// recordingNotifier keeps every payload sent to it
+type recordingNotifier struct {
+	payloads []WebhookPayload
+}
+
+func (n *recordingNotifier) Send(payload WebhookPayload) error {
+	n.payloads = append(n.payloads, payload)
+	return nil
+}
+
+func TestRunSummaryWithManyAccountsFitsDiscordLimits(t *testing.T) {
+	strategy := &Strategy{Name: "default", PuzzlesPerDay: 25}
+	var results []ProcessResult
+	for i := range 200 {
+		result := ProcessResult{
+			AccountUsername: fmt.Sprintf("synthetic_account_%03d", i),
+			PuzzlesSolved:   25,
+			Strategy:        strategy,
+			InitialRating:   1500 + i,
+			FinalRating:     1510 + i,
+		}
+		if i%4 == 0 {
+			result.Error = errors.New("invalid cookie")
+		}
+		results = append(results, result)
+	}
+
+	notifier := &recordingNotifier{}
+	sendRunSummary(notifier, results, false, "")
+	if len(notifier.payloads) != 1 {
+		t.Fatalf("sent %d payloads, want 1", len(notifier.payloads))
+	}
+
+	var values strings.Builder
+	for i, embed := range notifier.payloads[0].Embeds {
+		if size := embedSize(embed); size > embedTotalLimit {
+			t.Errorf("embed %d has size %d, over %d", i, size, embedTotalLimit)
+		}
+		if len(embed.Fields) > embedFieldCountLimit {
+			t.Errorf("embed %d has %d fields, over %d", i, len(embed.Fields), embedFieldCountLimit)
+		}
+		for _, field := range embed.Fields {
+			if n := utf8.RuneCountInString(field.Value); n > embedFieldValueLimit {
+				t.Errorf("field %q of embed %d has %d characters, over %d", field.Name, i, n, embedFieldValueLimit)
+			}
+			values.WriteString(field.Value + "\n")
+		}
+	}
+	// Nothing may be dropped along the way
+	for _, result := range results {
+		if !strings.Contains(values.String(), result.AccountUsername) {
+			t.Errorf("%s is missing from the summary", result.AccountUsername)
+		}
+	}
+
+	for i, message := range splitPayload(notifier.payloads[0]) {
+		size := 0
+		for _, embed := range message.Embeds {
+			size += embedSize(embed)
+		}
+		if size > embedTotalLimit || len(message.Embeds) > embedsPerMessageLimit {
+			t.Errorf("message %d has %d embeds of total size %d", i, len(message.Embeds), size)
+		}
+	}
+}
+
+func TestSplitPayload(t *testing.T) {
+	tests := []struct {
+		embeds int
+		want   []int // Embeds per message
+	}{
+		{embeds: 0, want: []int{0}},
+		{embeds: 1, want: []int{1}},
+		{embeds: 10, want: []int{10}},
+		{embeds: 11, want: []int{10, 1}},
+		{embeds: 23, want: []int{10, 10, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d embeds", tt.embeds), func(t *testing.T) {
+			payload := WebhookPayload{Content: "<@123>"}
+			for i := range tt.embeds {
+				payload.Embeds = append(payload.Embeds, Embed{Title: fmt.Sprintf("Account %d", i)})
+			}
+
+			messages := splitPayload(payload)
+			var got []int
+			var titles []string
+			for _, message := range messages {
+				got = append(got, len(message.Embeds))
+				for _, embed := range message.Embeds {
+					titles = append(titles, embed.Title)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("embeds per message = %v, want %v", got, tt.want)
+			}
+			for i, title := range titles {
+				if want := fmt.Sprintf("Account %d", i); title != want {
+					t.Fatalf("embed %d is %q, want %q", i, title, want)
+				}
+			}
+			if messages[0].Content != payload.Content {
+				t.Errorf("first message content = %q, want %q", messages[0].Content, payload.Content)
+			}
+			for i, message := range messages[1:] {
+				if message.Content != "" {
+					t.Errorf("message %d repeats the content", i+1)
+				}
+			}
+		})
+	}
+}
@@ -2,43 +2,78 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os/exec"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // ChessEngine represents a UCI chess engine (e.g., Stockfish)
 type ChessEngine struct {
-	Path     string
-	Threads  int
-	Hash     int // Hash size in MB
-	MultiPV  int // Number of principal variations
-	Depth    int // Search depth limit
-	cmd      *exec.Cmd
-	stdin    *bufio.Writer
-	stdout   *bufio.Scanner
-	ready    bool
+	Path         string
+	Threads      int
+	Hash         int               // Hash size in MB
+	MultiPV      int               // Number of principal variations
+	Depth        int               // Search depth limit
+	Options      map[string]string // Extra UCI options set on start, e.g. SyzygyPath
+	procMu       sync.Mutex        // Guards cmd and exited, which Restart replaces while Done, Kill and Stop read them
+	cmd          *exec.Cmd
+	stdin        *bufio.Writer
+	stdout       *engineOutput
+	ready        atomic.Bool   // Set once the engine answered readyok, cleared when its output ends
+	stopped      atomic.Bool   // Set by Stop, so an exit can be told apart from a crash
+	exited       chan struct{} // Closed when the engine process exits
+	mu           sync.Mutex    // Serializes searches and guards stdin and stdout, the engine process handles one search at a time
+	waiting      atomic.Int32  // Searches queued for mu, a ponder search is not started while any are
+	ponderMu     sync.Mutex    // Guards ponder and writes to the engine while it ponders
+	ponder       *PonderSearch // The running ponder search, nil when the engine isn't pondering
+	ponderOption bool          // Set once the Ponder option was sent to the current process
+}
+
+// PonderSearch is a search started in ponder mode on the position after the reply we expect
+type PonderSearch struct {
+	FEN    string // The position being pondered
+	done   chan struct{}
+	result *EngineAnalysis
+	err    error
 }
 
 // EngineAnalysis represents the engine's analysis of a position
 type EngineAnalysis struct {
-	BestMove  string
-	Score     int
-	Depth     int
-	Nodes     int64
-	Time      int // in milliseconds
-	PV        []string
+	BestMove   string
+	Score      int // Centipawns from the side to move's point of view, as UCI engines report it
+	Depth      int
+	Nodes      int64
+	TBHits     int64 // Tablebase positions probed during the search
+	Time       int   // in milliseconds
+	Mate       int   // Moves to mate, negative when being mated, 0 when Score is a centipawn score
+	PV         []string
+	PonderMove string // The opponent reply the engine expects, when it reported one
 	Variations []EngineVariation
 }
 
-// EngineVariation represents a principal variation from MultiPV analysis
+// EngineVariation represents a principal variation from MultiPV analysis. EngineAnalysis holds the
+// best line itself, its Variations are the second best line onwards
 type EngineVariation struct {
 	Move  string
-	Score int
+	Score int // Same perspective as EngineAnalysis.Score
+	Mate  int // Same as EngineAnalysis.Mate
 	PV    []string
 }
 
+// SearchProgress is the move the engine reported to be searching, from its currmove info lines
+type SearchProgress struct {
+	Depth          int
+	CurrMove       string
+	CurrMoveNumber int // 1-based, in the order the engine searches the moves
+}
+
 // NewChessEngine creates a new chess engine instance
 func NewChessEngine(path string, threads, hash, multipv, depth int) *ChessEngine {
 	return &ChessEngine{
@@ -47,43 +82,77 @@ func NewChessEngine(path string, threads, hash, multipv, depth int) *ChessEngine
 		Hash:    hash,
 		MultiPV: multipv,
 		Depth:   depth,
-		ready:   false,
 	}
 }
 
-// Start initializes and starts the chess engine
+// SetSyzygyPath points the engine at Syzygy tablebases, separated by ':' (';' on Windows), taking
+// effect on the next start. An empty path leaves the engine without tablebases
+func (e *ChessEngine) SetSyzygyPath(path string) {
+	if path == "" {
+		delete(e.Options, "SyzygyPath")
+		return
+	}
+	if e.Options == nil {
+		e.Options = make(map[string]string)
+	}
+	e.Options["SyzygyPath"] = path
+}
+
+// Start initializes and starts the chess engine. It fails when the engine exits before
+// answering uciok and readyok
 func (e *ChessEngine) Start() error {
-	e.cmd = exec.Command(e.Path)
-	
-	stdin, err := e.cmd.StdinPipe()
+	cmd := exec.Command(e.Path)
+
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdin pipe: %w", err)
 	}
-	e.stdin = bufio.NewWriter(stdin)
-	
-	stdout, err := e.cmd.StdoutPipe()
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
-	e.stdout = bufio.NewScanner(stdout)
-	
-	if err := e.cmd.Start(); err != nil {
+
+	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start engine: %w", err)
 	}
-	
-	// Initialize UCI
+	exited := make(chan struct{})
+	e.stdin = bufio.NewWriter(stdin)
+	e.stdout = readEngineOutput(stdout, func() {
+		// Wait closes stdout, so it is only called once everything has been read from it
+		cmd.Wait()
+		e.ready.Store(false)
+		close(exited)
+	})
+	e.stopped.Store(false)
+	e.ponderOption = false
+	e.procMu.Lock()
+	e.cmd, e.exited = cmd, exited
+	e.procMu.Unlock()
+
+	if err := e.initialize(); err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+	e.ready.Store(true)
+	select {
+	case <-exited:
+		// Exited right after answering, don't leave it marked as ready
+		e.ready.Store(false)
+		return fmt.Errorf("engine exited after starting")
+	default:
+	}
+	return nil
+}
+
+// initialize sets up a just started engine process through UCI and waits until it is ready
+func (e *ChessEngine) initialize() error {
 	if err := e.sendCommand("uci"); err != nil {
 		return err
 	}
-	
-	// Wait for uciok
-	for e.stdout.Scan() {
-		line := e.stdout.Text()
-		if strings.HasPrefix(line, "uciok") {
-			break
-		}
+	if !e.waitFor("uciok") {
+		return fmt.Errorf("engine exited before answering uciok: %w", e.outputErr())
 	}
-	
+
 	// Set options
 	if err := e.sendCommand(fmt.Sprintf("setoption name Threads value %d", e.Threads)); err != nil {
 		return err
@@ -96,21 +165,128 @@ func (e *ChessEngine) Start() error {
 			return err
 		}
 	}
-	
-	// Send isready and wait for readyok
+	// Sorted so the engine sees the options in the same order on every start
+	names := make([]string, 0, len(e.Options))
+	for name := range e.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := e.sendCommand(fmt.Sprintf("setoption name %s value %s", name, e.Options[name])); err != nil {
+			return err
+		}
+	}
+
 	if err := e.sendCommand("isready"); err != nil {
 		return err
 	}
-	
+	if !e.waitFor("readyok") {
+		return fmt.Errorf("engine exited before answering readyok: %w", e.outputErr())
+	}
+	return nil
+}
+
+// waitFor reads the engine output up to a line starting with prefix, reporting false when the
+// output ended first
+func (e *ChessEngine) waitFor(prefix string) bool {
 	for e.stdout.Scan() {
-		line := e.stdout.Text()
-		if strings.HasPrefix(line, "readyok") {
-			e.ready = true
-			break
+		if strings.HasPrefix(e.stdout.Text(), prefix) {
+			return true
 		}
 	}
-	
-	return nil
+	return false
+}
+
+// outputErr describes why the engine output ended
+func (e *ChessEngine) outputErr() error {
+	if err := e.stdout.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// engineOutput is the engine's stdout, read into a queue by a goroutine of its own so the end of
+// the output is noticed even while no search is reading it. Scan, Text and Err work like
+// bufio.Scanner's, for one reader at a time
+type engineOutput struct {
+	mu    sync.Mutex
+	lines []string
+	ended bool
+	err   error
+	more  chan struct{} // Signalled when lines are queued or the output ends
+	line  string
+}
+
+// readEngineOutput starts reading r, calling ended, when not nil, once it has been read to the end
+func readEngineOutput(r io.Reader, ended func()) *engineOutput {
+	o := &engineOutput{more: make(chan struct{}, 1)}
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			o.mu.Lock()
+			o.lines = append(o.lines, scanner.Text())
+			o.mu.Unlock()
+			o.signal()
+		}
+		o.mu.Lock()
+		o.ended, o.err = true, scanner.Err()
+		o.mu.Unlock()
+		if ended != nil {
+			ended()
+		}
+		o.signal()
+	}()
+	return o
+}
+
+func (o *engineOutput) signal() {
+	select {
+	case o.more <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the next line, waiting for one until the output ends or timeout fires. A nil
+// timeout waits without a limit
+func (o *engineOutput) next(timeout <-chan time.Time) (line string, ok bool) {
+	for {
+		o.mu.Lock()
+		if len(o.lines) > 0 {
+			line = o.lines[0]
+			o.lines = o.lines[1:]
+			o.mu.Unlock()
+			return line, true
+		}
+		ended := o.ended
+		o.mu.Unlock()
+		if ended {
+			return "", false
+		}
+		select {
+		case <-o.more:
+		case <-timeout:
+			return "", false
+		}
+	}
+}
+
+// Scan waits for the next line, reporting false once the output has ended
+func (o *engineOutput) Scan() bool {
+	var ok bool
+	o.line, ok = o.next(nil)
+	return ok
+}
+
+// Text returns the line read by the last Scan
+func (o *engineOutput) Text() string {
+	return o.line
+}
+
+// Err returns the error that ended the output, nil when it ended normally or hasn't ended
+func (o *engineOutput) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
 }
 
 // sendCommand sends a command to the engine
@@ -121,56 +297,154 @@ func (e *ChessEngine) sendCommand(cmd string) error {
 	return e.stdin.Flush()
 }
 
+// SearchLimit is what ends a search. Zero fields are left out, when several are set the search
+// stops at whichever is reached first
+type SearchLimit struct {
+	Depth    int
+	Nodes    int64
+	MoveTime time.Duration
+}
+
+// goCommand returns the UCI go command for the limit
+func (l SearchLimit) goCommand() string {
+	goCmd := "go"
+	if l.Depth > 0 {
+		goCmd += fmt.Sprintf(" depth %d", l.Depth)
+	}
+	if l.Nodes > 0 {
+		goCmd += fmt.Sprintf(" nodes %d", l.Nodes)
+	}
+	if l.MoveTime > 0 {
+		goCmd += fmt.Sprintf(" movetime %d", l.MoveTime.Milliseconds())
+	}
+	return goCmd
+}
+
 // AnalyzePosition analyzes a chess position and returns the best move
 func (e *ChessEngine) AnalyzePosition(fen string, thinkTime time.Duration) (*EngineAnalysis, error) {
-	if !e.ready {
+	return e.AnalyzePositionToDepth(fen, thinkTime, e.Depth)
+}
+
+// AnalyzePositionToDepth is AnalyzePosition with the engine's depth limit replaced by depth,
+// searching for thinkTime instead when depth is 0
+func (e *ChessEngine) AnalyzePositionToDepth(fen string, thinkTime time.Duration, depth int) (*EngineAnalysis, error) {
+	if depth > 0 {
+		return e.AnalyzeWithLimit(fen, SearchLimit{Depth: depth})
+	}
+	return e.AnalyzeWithLimit(fen, SearchLimit{MoveTime: thinkTime})
+}
+
+// AnalyzePositionWithin searches to depth (or without a depth limit when it is 0) but never for
+// longer than maxTime, for when the game clock has to be respected
+func (e *ChessEngine) AnalyzePositionWithin(fen string, depth int, maxTime time.Duration) (*EngineAnalysis, error) {
+	return e.AnalyzeWithLimit(fen, SearchLimit{Depth: depth, MoveTime: maxTime})
+}
+
+// AnalyzeWithLimit analyzes a position until the limit is reached. A limit without any field set
+// would search forever, so it is refused
+func (e *ChessEngine) AnalyzeWithLimit(fen string, limit SearchLimit) (*EngineAnalysis, error) {
+	return e.AnalyzeWithProgress(fen, limit, nil)
+}
+
+// AnalyzeWithProgress is AnalyzeWithLimit calling onProgress, when not nil, whenever the engine
+// reports which move it is searching. onProgress runs on the search and should return quickly
+func (e *ChessEngine) AnalyzeWithProgress(fen string, limit SearchLimit, onProgress func(SearchProgress)) (*EngineAnalysis, error) {
+	if limit == (SearchLimit{}) {
+		return nil, fmt.Errorf("search limit not set")
+	}
+	return e.analyze(fen, limit.goCommand(), onProgress)
+}
+
+// SetMultiPV changes how many principal variations the engine searches and waits until the engine
+// is ready with it. The new value is also used when the engine is restarted
+func (e *ChessEngine) SetMultiPV(multiPV int) error {
+	e.waiting.Add(1)
+	e.preemptPonder()
+	e.mu.Lock()
+	e.waiting.Add(-1)
+	defer e.mu.Unlock()
+
+	if multiPV == e.MultiPV {
+		return nil
+	}
+	if !e.ready.Load() {
+		return fmt.Errorf("engine not ready")
+	}
+	if err := e.sendCommand(fmt.Sprintf("setoption name MultiPV value %d", multiPV)); err != nil {
+		return err
+	}
+	if err := e.sendCommand("isready"); err != nil {
+		return err
+	}
+	if !e.waitFor("readyok") {
+		e.ready.Store(false)
+		return fmt.Errorf("engine stopped responding")
+	}
+	e.MultiPV = multiPV
+	return nil
+}
+
+// analyze sets up the position, runs goCmd and parses the engine output until bestmove
+func (e *ChessEngine) analyze(fen string, goCmd string, onProgress func(SearchProgress)) (*EngineAnalysis, error) {
+	// A ponder search holds the engine until the opponent moves, other searches don't wait for it
+	e.waiting.Add(1)
+	e.preemptPonder()
+	e.mu.Lock()
+	e.waiting.Add(-1)
+	defer e.mu.Unlock()
+
+	if !e.ready.Load() {
 		return nil, fmt.Errorf("engine not ready")
 	}
-	
+
 	// Start new game
 	if err := e.sendCommand("ucinewgame"); err != nil {
 		return nil, err
 	}
-	
+
 	// Wait for ready
 	if err := e.sendCommand("isready"); err != nil {
 		return nil, err
 	}
-	for e.stdout.Scan() {
-		line := e.stdout.Text()
-		if strings.HasPrefix(line, "readyok") {
-			break
-		}
+	if !e.waitFor("readyok") {
+		e.ready.Store(false)
+		return nil, fmt.Errorf("engine stopped responding")
 	}
-	
+
 	// Set position
 	if err := e.sendCommand(fmt.Sprintf("position fen %s", fen)); err != nil {
 		return nil, err
 	}
-	
+
 	// Start analysis
-	var goCmd string
-	if e.Depth > 0 {
-		goCmd = fmt.Sprintf("go depth %d", e.Depth)
-	} else {
-		goCmd = fmt.Sprintf("go movetime %d", thinkTime.Milliseconds())
-	}
-	
 	if err := e.sendCommand(goCmd); err != nil {
 		return nil, err
 	}
-	
+
+	return e.readSearch(onProgress)
+}
+
+// readSearch parses the engine output of a running search until bestmove, passing currmove info
+// lines to onProgress when it isn't nil
+func (e *ChessEngine) readSearch(onProgress func(SearchProgress)) (*EngineAnalysis, error) {
 	analysis := &EngineAnalysis{
 		Variations: make([]EngineVariation, 0),
 	}
-	
+
 	// Parse output
 	for e.stdout.Scan() {
 		line := e.stdout.Text()
-		
+
 		if strings.HasPrefix(line, "info") {
 			// Parse info lines for score, depth, nodes, etc.
 			parts := strings.Fields(line)
+			// currmove comes on lines of its own, without a score or pv
+			var progress SearchProgress
+			// With MultiPV the engine reports each line separately, numbered from 1 for the best one
+			multiPV := 1
+			hasScore := false
+			var score, mate int
+			var pv []string
 			for i, part := range parts {
 				switch part {
 				case "depth":
@@ -181,43 +455,331 @@ func (e *ChessEngine) AnalyzePosition(fen string, thinkTime time.Duration) (*Eng
 					if i+1 < len(parts) {
 						fmt.Sscanf(parts[i+1], "%d", &analysis.Nodes)
 					}
+				case "tbhits":
+					if i+1 < len(parts) {
+						fmt.Sscanf(parts[i+1], "%d", &analysis.TBHits)
+					}
 				case "time":
 					if i+1 < len(parts) {
 						fmt.Sscanf(parts[i+1], "%d", &analysis.Time)
 					}
+				case "multipv":
+					if i+1 < len(parts) {
+						fmt.Sscanf(parts[i+1], "%d", &multiPV)
+					}
 				case "score":
 					if i+2 < len(parts) && parts[i+1] == "cp" {
-						fmt.Sscanf(parts[i+2], "%d", &analysis.Score)
+						fmt.Sscanf(parts[i+2], "%d", &score)
+						hasScore = true
+					} else if i+2 < len(parts) && parts[i+1] == "mate" {
+						fmt.Sscanf(parts[i+2], "%d", &mate)
+						hasScore = true
+					}
+				case "currmove":
+					if i+1 < len(parts) {
+						progress.CurrMove = parts[i+1]
+					}
+				case "currmovenumber":
+					if i+1 < len(parts) {
+						fmt.Sscanf(parts[i+1], "%d", &progress.CurrMoveNumber)
 					}
 				case "pv":
 					if i+1 < len(parts) {
-						analysis.PV = parts[i+1:]
+						pv = parts[i+1:]
 					}
 				}
 			}
+			analysis.addLine(multiPV, hasScore, score, mate, pv)
+			if progress.CurrMove != "" && onProgress != nil {
+				progress.Depth = analysis.Depth
+				onProgress(progress)
+			}
 		} else if strings.HasPrefix(line, "bestmove") {
 			parts := strings.Fields(line)
 			if len(parts) >= 2 {
 				analysis.BestMove = parts[1]
 			}
+			if len(parts) >= 4 && parts[2] == "ponder" {
+				analysis.PonderMove = parts[3]
+			}
 			break
 		}
 	}
-	
+
 	if analysis.BestMove == "" {
+		if e.stdout.Err() != nil || !strings.HasPrefix(e.stdout.Text(), "bestmove") {
+			// The scanner only stops early when the engine's output closed, i.e. the process died
+			e.ready.Store(false)
+			return nil, fmt.Errorf("engine stopped responding")
+		}
 		return nil, fmt.Errorf("no best move found")
 	}
-	
+
 	return analysis, nil
 }
 
+// addLine records the score and pv of one info line: the best line's (multipv 1, or no multipv)
+// on the analysis itself and the others' in Variations. Lines without a score or pv leave what
+// was recorded for them before
+func (a *EngineAnalysis) addLine(multiPV int, hasScore bool, score, mate int, pv []string) {
+	if multiPV <= 1 {
+		if hasScore {
+			a.Score, a.Mate = score, mate
+		}
+		if pv != nil {
+			a.PV = pv
+		}
+		return
+	}
+
+	// Lines can arrive out of order when a search is stopped, the gaps are filled in later
+	for len(a.Variations) < multiPV-1 {
+		a.Variations = append(a.Variations, EngineVariation{})
+	}
+	variation := &a.Variations[multiPV-2]
+	if hasScore {
+		variation.Score, variation.Mate = score, mate
+	}
+	if pv != nil {
+		variation.PV = pv
+		variation.Move = pv[0]
+	}
+}
+
+// errPonderPreempted is returned by PonderHit when another search stopped the ponder search
+var errPonderPreempted = errors.New("ponder search was preempted")
+
+// StartPonder searches fen, the position after the reply we expect, in ponder mode until PonderHit
+// or StopPonder. After ponderhit the search continues as a normal one with the given limits. It
+// returns nil without pondering when the engine is busy or other searches are waiting for it
+func (e *ChessEngine) StartPonder(fen string, depth int, maxTime time.Duration) (*PonderSearch, error) {
+	if !e.mu.TryLock() {
+		return nil, nil
+	}
+	e.ponderMu.Lock()
+	defer e.ponderMu.Unlock()
+
+	// Checked under ponderMu, so a search queued after this either sees the ponder search and stops it or is seen here
+	if e.waiting.Load() > 0 || !e.ready.Load() {
+		e.mu.Unlock()
+		return nil, nil
+	}
+
+	goCmd := fmt.Sprintf("go ponder movetime %d", maxTime.Milliseconds())
+	if depth > 0 {
+		goCmd = fmt.Sprintf("go ponder depth %d movetime %d", depth, maxTime.Milliseconds())
+	}
+	commands := []string{fmt.Sprintf("position fen %s", fen), goCmd}
+	if !e.ponderOption {
+		commands = append([]string{"setoption name Ponder value true"}, commands...)
+	}
+	for _, cmd := range commands {
+		if err := e.sendCommand(cmd); err != nil {
+			e.mu.Unlock()
+			return nil, err
+		}
+	}
+	e.ponderOption = true
+
+	search := &PonderSearch{FEN: fen, done: make(chan struct{})}
+	e.ponder = search
+	go func() {
+		search.result, search.err = e.readSearch(nil)
+		e.mu.Unlock()
+		close(search.done)
+	}()
+
+	return search, nil
+}
+
+// PonderHit tells the engine the expected reply was played and waits for the search to finish
+func (e *ChessEngine) PonderHit(search *PonderSearch) (*EngineAnalysis, error) {
+	if !e.endPonder(search, "ponderhit") {
+		<-search.done
+		return nil, errPonderPreempted
+	}
+	<-search.done
+	return search.result, search.err
+}
+
+// StopPonder stops a ponder search whose expected reply wasn't played, discarding its result
+func (e *ChessEngine) StopPonder(search *PonderSearch) {
+	e.endPonder(search, "stop")
+	<-search.done
+}
+
+// endPonder sends cmd to end search, reporting false when it was no longer the running ponder search
+func (e *ChessEngine) endPonder(search *PonderSearch, cmd string) bool {
+	e.ponderMu.Lock()
+	defer e.ponderMu.Unlock()
+	if e.ponder != search {
+		return false
+	}
+	e.ponder = nil
+	e.sendCommand(cmd)
+	return true
+}
+
+// preemptPonder stops the running ponder search, if any, and waits for it to let go of the engine
+func (e *ChessEngine) preemptPonder() {
+	e.ponderMu.Lock()
+	search := e.ponder
+	if search != nil {
+		e.ponder = nil
+		e.sendCommand("stop")
+	}
+	e.ponderMu.Unlock()
+	if search != nil {
+		<-search.done
+	}
+}
+
+// Running reports whether the engine started and hasn't been seen to die or been stopped since
+func (e *ChessEngine) Running() bool {
+	return e.ready.Load()
+}
+
+// mateScoreCp is the centipawn value ScoreCp uses for forced mates
+const mateScoreCp = 100000
+
+// ScoreCp returns the score in centipawns from the side to move's perspective, with mates as +/-mateScoreCp
+func (a *EngineAnalysis) ScoreCp() int {
+	switch {
+	case a.Mate > 0:
+		return mateScoreCp
+	case a.Mate < 0:
+		return -mateScoreCp
+	default:
+		return a.Score
+	}
+}
+
+// FromWhitePerspective returns the analysis of fen with its scores, including the variations',
+// negated when Black is to move, so positive scores and mates always favor White
+func (a *EngineAnalysis) FromWhitePerspective(fen string) *EngineAnalysis {
+	if _, side, err := fenPlacement(fen); err != nil || side != "b" {
+		return a
+	}
+	flipped := *a
+	flipped.Score = -a.Score
+	flipped.Mate = -a.Mate
+	flipped.Variations = make([]EngineVariation, len(a.Variations))
+	for i, variation := range a.Variations {
+		variation.Score = -variation.Score
+		variation.Mate = -variation.Mate
+		flipped.Variations[i] = variation
+	}
+	return &flipped
+}
+
+// NormalizeEval maps a score to a 0-1 value for eval bars, like a win probability for the side the
+// score is for: 0.5 for an equal position, 1/(1+10^(-cp/400)) in general. A mate (mateIn not 0)
+// is 1 when delivering it and 0 when being mated, whatever cp says
+func NormalizeEval(cp int, mateIn int) float64 {
+	switch {
+	case mateIn > 0:
+		return 1
+	case mateIn < 0:
+		return 0
+	default:
+		return 1 / (1 + math.Pow(10, -float64(cp)/400))
+	}
+}
+
+// engineQuitTimeout is how long Stop waits for the engine to quit before killing it
+const engineQuitTimeout = 5 * time.Second
+
 // Stop stops the chess engine
 func (e *ChessEngine) Stop() error {
-	if e.cmd != nil && e.cmd.Process != nil {
+	e.stopped.Store(true)
+	e.ready.Store(false)
+	cmd, exited := e.process()
+	if cmd != nil && cmd.Process != nil {
+		select {
+		case <-exited:
+			return nil
+		default:
+		}
 		if err := e.sendCommand("quit"); err != nil {
-			return err
+			return cmd.Process.Kill()
+		}
+		select {
+		case <-exited:
+		case <-time.After(engineQuitTimeout):
+			return cmd.Process.Kill()
 		}
-		return e.cmd.Wait()
 	}
 	return nil
 }
+
+// process returns the engine process started by the last Start and the channel closed when it exits
+func (e *ChessEngine) process() (*exec.Cmd, chan struct{}) {
+	e.procMu.Lock()
+	defer e.procMu.Unlock()
+	return e.cmd, e.exited
+}
+
+// Done returns a channel that is closed when the engine process started by the last Start exits
+func (e *ChessEngine) Done() <-chan struct{} {
+	_, exited := e.process()
+	return exited
+}
+
+// Stopped reports whether the engine was shut down with Stop rather than exiting on its own
+func (e *ChessEngine) Stopped() bool {
+	return e.stopped.Load()
+}
+
+// Kill kills the engine process without marking the engine as stopped, so a supervisor restarts it
+func (e *ChessEngine) Kill() error {
+	cmd, _ := e.process()
+	if cmd == nil || cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// Restart kills the engine process if it is still running and starts a new one with the same settings
+func (e *ChessEngine) Restart() error {
+	// Killed before taking the lock, a hung search only lets go of it once the output closes
+	if cmd, exited := e.process(); cmd != nil && cmd.Process != nil {
+		select {
+		case <-exited:
+		default:
+			cmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.Start()
+}
+
+// IsHealthy checks the engine answers isready with readyok within timeout. An engine busy with
+// a search counts as healthy. The engine is unlocked again when it doesn't answer in time, its
+// late readyok is then read by the next command waiting for one, which is harmless as the engine
+// answers commands in order
+func (e *ChessEngine) IsHealthy(timeout time.Duration) bool {
+	if !e.ready.Load() {
+		return false
+	}
+	if !e.mu.TryLock() {
+		return true
+	}
+	defer e.mu.Unlock()
+
+	if err := e.sendCommand("isready"); err != nil {
+		return false
+	}
+	deadline := time.After(timeout)
+	for {
+		line, ok := e.stdout.next(deadline)
+		if !ok {
+			return false
+		}
+		if strings.HasPrefix(line, "readyok") {
+			return true
+		}
+	}
+}
@@ -3,11 +3,18 @@ package main
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,7 +25,6 @@ type EngineServer struct {
 	engine              *ChessEngine
 	upgrader            websocket.Upgrader
 	passKey             string
-	engineInputChannel  chan string
 	engineOutputChannel chan string
 	users               map[*websocket.Conn]*EngineUser
 	usersMu             sync.RWMutex
@@ -27,14 +33,41 @@ type EngineServer struct {
 	localhostBypass     bool
 	engineLock          sync.Mutex
 	engineOwner         *websocket.Conn
+	commandRate         float64
+	commandBurst        int
+	maxMoveTime         time.Duration
+	defaultMultiPV      int                       // MultiPV for lock owners that didn't ask for their own
+	sessions            map[string]*engineSession // By resume token, guarded by usersMu
+	metrics             engineMetrics
+	restarting          atomic.Bool
 }
 
-// EngineUser represents a connected user
+// engineMetrics are the counters served on /metrics
+type engineMetrics struct {
+	analyses       atomic.Int64
+	analysisErrors atomic.Int64
+	analysisNanos  atomic.Int64 // Total time spent in successful analyses
+	tbHits         atomic.Int64 // Tablebase probes reported by the engine
+	engineRestarts atomic.Int64
+}
+
+// EngineUser represents a connected user. Its handleMessage calls run on the connection's readPump,
+// but RotatePasskey and writePump use it from other goroutines, so the fields they share are guarded
 type EngineUser struct {
-	conn         *websocket.Conn
-	authenticated bool
-	subscribed    bool
-	hasLock       bool
+	conn             *websocket.Conn
+	writeMu          sync.Mutex   // Serializes writes to conn, which allows only one writer at a time
+	authenticated    bool         // Guarded by the server's usersMu
+	subscribed       atomic.Bool  // Read by writePump
+	hasLock          bool         // Guarded by the server's engineLock
+	localBypass      bool         // Authenticated by the localhost bypass rather than the passkey
+	verbose          bool         // Set by "verbose on", bestmove replies then carry the score and PV
+	negotiated       bool         // Set after the first message, which may switch the connection to JSON
+	json             bool         // Messages are exchanged as JSON instead of text lines, guarded by writeMu
+	resumeToken      string       // Issued on auth, lets the client resume after reconnecting
+	multiPV          int          // Set by setmultipv, applied whenever this user gets the lock. 0 for the server's default
+	fen              string       // Set by position and searched by go, empty for the starting position
+	whitePerspective bool         // Set by "perspective white", scores are then from White's point of view instead of the side to move's
+	limiter          *tokenBucket // Limits position/go commands, nil when rate limiting is off
 }
 
 // EngineConfig represents engine server configuration
@@ -45,20 +78,91 @@ type EngineConfig struct {
 	Hash            int
 	MultiPV         int
 	Depth           int
+	SyzygyPath      string // Syzygy tablebase directories for the engine, empty for none
 	RequireAuth     bool
 	LocalhostBypass bool
+	Passkey         string  // Reused when set so clients don't need a new passkey after a restart
+	CommandRate     float64 // position/go commands allowed per second for each connection, 0 for no limit
+	CommandBurst    int     // How many position/go commands a connection may send at once before being limited
+	MaxMoveTimeMs   int     // Longest search a client may ask for with go movetime, 0 for defaultMaxMoveTime
 }
 
-// NewEngineServer creates a new engine server
-func NewEngineServer(config *EngineConfig) (*EngineServer, error) {
-	// Generate random passkey
+// defaultMaxMoveTime caps go movetime when EngineConfig.MaxMoveTimeMs isn't set, so one client
+// can't hold a shared engine for minutes
+const defaultMaxMoveTime = 10 * time.Second
+
+// resumeTokenTTL is how long after a connection drops its resume token can still be used
+const resumeTokenTTL = 2 * time.Minute
+
+// engineSession is what a resume token restores on a new connection
+type engineSession struct {
+	user             *EngineUser // The connection using the token, nil once it dropped
+	expires          time.Time   // Set when the connection drops
+	hadLock          bool
+	verbose          bool
+	multiPV          int
+	whitePerspective bool
+}
+
+// maxClientMultiPV bounds setmultipv, every extra line makes each search slower for everyone
+const maxClientMultiPV = 10
+
+// errResumeFailed is sent for resume tokens that are unknown, expired or revoked by a passkey rotation
+var errResumeFailed = errors.New("invalid or expired resume token")
+
+// Bounds on go depth and go nodes. Depth and node searches are also stopped after the max move
+// time, a deep search of a complicated position could otherwise run for a very long time
+const (
+	maxGoDepth = 60
+	maxGoNodes = 1_000_000_000
+)
+
+// errUnsupportedGo is sent for go commands with parameters the server doesn't handle
+var errUnsupportedGo = errors.New("unsupported go parameters")
+
+// generatePasskey returns a new random passkey
+func generatePasskey() (string, error) {
 	passKeyBytes := make([]byte, 16)
 	if _, err := rand.Read(passKeyBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate passkey: %w", err)
+		return "", fmt.Errorf("failed to generate passkey: %w", err)
+	}
+	return hex.EncodeToString(passKeyBytes), nil
+}
+
+// loadPasskey reads a passkey saved by savePasskey, returning "" when there is none yet
+func loadPasskey(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// savePasskey stores the passkey so the next server start reuses it
+func savePasskey(path, passKey string) error {
+	return writeFileAtomic(path, []byte(passKey+"\n"), 0600)
+}
+
+// NewEngineServer creates a new engine server
+func NewEngineServer(config *EngineConfig) (*EngineServer, error) {
+	passKey := config.Passkey
+	if passKey == "" {
+		var err error
+		if passKey, err = generatePasskey(); err != nil {
+			return nil, err
+		}
 	}
-	passKey := hex.EncodeToString(passKeyBytes)
 
 	engine := NewChessEngine(config.EnginePath, config.Threads, config.Hash, config.MultiPV, config.Depth)
+	engine.SetSyzygyPath(config.SyzygyPath)
+
+	maxMoveTime := defaultMaxMoveTime
+	if config.MaxMoveTimeMs > 0 {
+		maxMoveTime = time.Duration(config.MaxMoveTimeMs) * time.Millisecond
+	}
 
 	return &EngineServer{
 		engine: engine,
@@ -68,46 +172,275 @@ func NewEngineServer(config *EngineConfig) (*EngineServer, error) {
 			},
 		},
 		passKey:             passKey,
-		engineInputChannel:  make(chan string, 100),
 		engineOutputChannel: make(chan string, 100),
 		users:               make(map[*websocket.Conn]*EngineUser),
 		address:             config.Address,
 		requireAuth:         config.RequireAuth,
 		localhostBypass:     config.LocalhostBypass,
+		commandRate:         config.CommandRate,
+		commandBurst:        config.CommandBurst,
+		maxMoveTime:         maxMoveTime,
+		defaultMultiPV:      max(config.MultiPV, 1),
+		sessions:            make(map[string]*engineSession),
 	}, nil
 }
 
+// PassKey returns the passkey clients authenticate with
+func (s *EngineServer) PassKey() string {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+	return s.passKey
+}
+
+// RotatePasskey replaces the passkey with a new random one. Authenticated connections lose their
+// authentication and any lock, and are told to authenticate again with the new passkey
+func (s *EngineServer) RotatePasskey() (string, error) {
+	passKey, err := generatePasskey()
+	if err != nil {
+		return "", err
+	}
+
+	s.usersMu.Lock()
+	s.passKey = passKey
+	var reauth []*EngineUser
+	for _, user := range s.users {
+		if user.authenticated && !user.localBypass {
+			user.authenticated = false
+			user.resumeToken = ""
+			reauth = append(reauth, user)
+		}
+	}
+	// Tokens were handed out for the old passkey
+	s.sessions = make(map[string]*engineSession)
+	s.usersMu.Unlock()
+
+	s.engineLock.Lock()
+	for _, user := range reauth {
+		if s.engineOwner == user.conn {
+			s.engineOwner = nil
+		}
+		user.hasLock = false
+	}
+	s.engineLock.Unlock()
+
+	for _, user := range reauth {
+		user.send("auth required: passkey rotated")
+	}
+	logger.Printf("Engine server passkey rotated, %d client(s) must authenticate again\n", len(reauth))
+	return passKey, nil
+}
+
 // Start starts the engine server
 func (s *EngineServer) Start() error {
 	logger.Printf("Starting engine server on %s\n", s.address)
-	logger.Printf("Passkey: %s\n", s.passKey)
+	logger.Printf("Passkey: %s\n", s.PassKey())
 
 	// Start engine
 	if err := s.engine.Start(); err != nil {
 		return fmt.Errorf("failed to start engine: %w", err)
 	}
+	go s.superviseEngine()
+	go s.probeEngine()
 
-	// Setup HTTP handlers
-	http.HandleFunc("/ws", s.handleWebSocket)
-	http.HandleFunc("/", s.handleRoot)
+	// Setup HTTP handlers on a mux of our own, the UI server uses the default one in the same process
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/userscript.user.js", s.handleUserscript)
+	mux.HandleFunc("/", s.handleRoot)
 
 	// Start server
-	return http.ListenAndServe(s.address, nil)
+	return http.ListenAndServe(s.address, mux)
+}
+
+const (
+	minRestartBackoff = time.Second
+	maxRestartBackoff = time.Minute
+	// stableEngineUptime is how long a restarted engine has to run for the backoff to be reset
+	stableEngineUptime = time.Minute
+)
+
+// superviseEngine restarts the engine whenever its process exits without Stop being called,
+// backing off exponentially while it keeps failing
+func (s *EngineServer) superviseEngine() {
+	backoff := minRestartBackoff
+	startedAt := time.Now()
+	for {
+		<-s.engine.Done()
+		if s.engine.Stopped() {
+			return
+		}
+		if time.Since(startedAt) > stableEngineUptime {
+			backoff = minRestartBackoff
+		}
+
+		s.restarting.Store(true)
+		for {
+			logger.Warnf("Engine process exited, restarting in %s...\n", backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxRestartBackoff)
+			if s.engine.Stopped() {
+				return
+			}
+			if err := s.engine.Restart(); err != nil {
+				logger.Errorf("Engine restart failed: %v\n", err)
+				continue
+			}
+			break
+		}
+		s.restarting.Store(false)
+		s.metrics.engineRestarts.Add(1)
+		startedAt = time.Now()
+		logger.Infof("Engine restarted\n")
+	}
+}
+
+const (
+	healthProbeInterval = 30 * time.Second
+	healthProbeTimeout  = 5 * time.Second
+	// unhealthyProbeLimit is how many probes in a row may fail before the engine is killed, which
+	// makes superviseEngine restart it
+	unhealthyProbeLimit = 2
+)
+
+// probeEngine periodically checks the engine still answers and kills it when it has hung
+func (s *EngineServer) probeEngine() {
+	ticker := time.NewTicker(healthProbeInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for range ticker.C {
+		if s.engine.Stopped() {
+			return
+		}
+		if s.restarting.Load() || s.engine.IsHealthy(healthProbeTimeout) {
+			failures = 0
+			continue
+		}
+		failures++
+		logger.Warnf("Engine health check failed (%d/%d)\n", failures, unhealthyProbeLimit)
+		if failures >= unhealthyProbeLimit {
+			logger.Errorf("Engine is unresponsive, killing it so it gets restarted\n")
+			s.engine.Kill()
+			failures = 0
+		}
+	}
+}
+
+// handleHealth answers 200 when the engine is up and responsive and 503 otherwise, for load balancers
+func (s *EngineServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	switch {
+	case s.restarting.Load():
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "engine restarting")
+	case !s.engine.IsHealthy(healthProbeTimeout):
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "engine unhealthy")
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// handleMetrics serves the server's counters in the Prometheus text format
+func (s *EngineServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	s.usersMu.RLock()
+	connections := len(s.users)
+	s.usersMu.RUnlock()
+
+	analyses := s.metrics.analyses.Load()
+	analysisSeconds := time.Duration(s.metrics.analysisNanos.Load()).Seconds()
+	averageSeconds := 0.0
+	if analyses > 0 {
+		averageSeconds = analysisSeconds / float64(analyses)
+	}
+	up := 0
+	if s.engine.Running() {
+		up = 1
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetric(w, "chesshook_engine_connections", "gauge", "Open WebSocket connections.", connections)
+	writeMetric(w, "chesshook_engine_analyses_total", "counter", "Analyses completed.", analyses)
+	writeMetric(w, "chesshook_engine_analysis_errors_total", "counter", "Analyses that failed.", s.metrics.analysisErrors.Load())
+	writeMetric(w, "chesshook_engine_analysis_seconds_total", "counter", "Time spent in completed analyses.", analysisSeconds)
+	writeMetric(w, "chesshook_engine_analysis_seconds_average", "gauge", "Average time of a completed analysis.", averageSeconds)
+	writeMetric(w, "chesshook_engine_tbhits_total", "counter", "Tablebase hits reported by the engine.", s.metrics.tbHits.Load())
+	writeMetric(w, "chesshook_engine_restarts_total", "counter", "Times the engine process was restarted.", s.metrics.engineRestarts.Load())
+	writeMetric(w, "chesshook_engine_up", "gauge", "Whether the engine process is running (1) or not (0).", up)
+}
+
+func writeMetric(w http.ResponseWriter, name, kind, help string, value any) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// engineRootTemplate is the page served on the engine server's root
+var engineRootTemplate = template.Must(template.ParseFS(templatesFS, "ui/templates/engine.html"))
+
+// engineRootData is what the root page shows
+type engineRootData struct {
+	Address     string
+	PassKey     string
+	Status      string
+	Connections int
+	Locked      bool
+	Analyses    int64
+	Restarts    int64
 }
 
 func (s *EngineServer) handleRoot(w http.ResponseWriter, r *http.Request) {
-	html := `<!DOCTYPE html>
-<html>
-<head><title>ChessHook Engine Server</title></head>
-<body>
-<h1>ChessHook Engine Server</h1>
-<p>Status: Running</p>
-<p>Connect via WebSocket at: ws://` + s.address + `/ws</p>
-<p>Passkey: <code>` + s.passKey + `</code></p>
-</body>
-</html>`
+	data := engineRootData{
+		Address:  s.address,
+		PassKey:  s.PassKey(),
+		Status:   "running",
+		Analyses: s.metrics.analyses.Load(),
+		Restarts: s.metrics.engineRestarts.Load(),
+	}
+	switch {
+	case s.restarting.Load():
+		data.Status = "restarting"
+	case !s.engine.Running():
+		data.Status = "down"
+	}
+	s.usersMu.RLock()
+	data.Connections = len(s.users)
+	s.usersMu.RUnlock()
+	s.engineLock.Lock()
+	data.Locked = s.engineOwner != nil
+	s.engineLock.Unlock()
+
 	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+	if err := engineRootTemplate.Execute(w, data); err != nil {
+		logger.Errorf("Failed to render the engine server page: %v\n", err)
+	}
+}
+
+// handleUserscript serves a userscript that uses this server, the same one `userscript generate
+// --engine external` would make with the server's address and passkey
+func (s *EngineServer) handleUserscript(w http.ResponseWriter, r *http.Request) {
+	depth := s.engine.Depth
+	if depth <= 0 {
+		depth = 20
+	}
+	config := UserscriptConfig{
+		Engine:            "external",
+		AutoMove:          "false",
+		ArrowColor:        "#77ff77",
+		ExternalEngineURL: "ws://" + s.address + "/ws",
+		PassKey:           s.PassKey(),
+		Depth:             depth,
+		MultiPV:           s.defaultMultiPV,
+	}
+
+	var builder strings.Builder
+	if err := GenerateUserscriptToWriter(&builder, config); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Content-Disposition", "attachment; filename=chesshook.user.js")
+	io.WriteString(w, builder.String())
 }
 
 func (s *EngineServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -117,26 +450,27 @@ func (s *EngineServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := &EngineUser{
-		conn:          conn,
-		authenticated: false,
-		subscribed:    false,
-		hasLock:       false,
-	}
+	user := &EngineUser{conn: conn}
 
 	// Check if localhost bypass is enabled
 	if s.localhostBypass && isLocalhost(r.RemoteAddr) {
 		user.authenticated = true
+		user.localBypass = true
+	}
+
+	// Each connection gets its own bucket, so reconnecting starts with a full one
+	if s.commandRate > 0 {
+		user.limiter = newTokenBucket(s.commandRate, s.commandBurst, time.Now)
 	}
 
 	s.usersMu.Lock()
 	s.users[conn] = user
 	s.usersMu.Unlock()
 
-	logger.Printf("New WebSocket connection from %s\n", r.RemoteAddr)
+	logger.Debugf("New WebSocket connection from %s\n", r.RemoteAddr)
 
 	// Send greeting
-	conn.WriteMessage(websocket.TextMessage, []byte("whoareyou"))
+	user.send("whoareyou")
 
 	go s.readPump(conn, user)
 	go s.writePump(conn, user)
@@ -144,10 +478,22 @@ func (s *EngineServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 func (s *EngineServer) readPump(conn *websocket.Conn, user *EngineUser) {
 	defer func() {
+		s.engineLock.Lock()
+		hadLock := user.hasLock
+		if hadLock && s.engineOwner == conn {
+			s.engineOwner = nil
+		}
+		s.engineLock.Unlock()
+
 		s.usersMu.Lock()
 		delete(s.users, conn)
-		if user.hasLock && s.engineOwner == conn {
-			s.engineOwner = nil
+		if session, ok := s.sessions[user.resumeToken]; ok && session.user == user {
+			session.user = nil
+			session.expires = time.Now().Add(resumeTokenTTL)
+			session.hadLock = hadLock
+			session.verbose = user.verbose
+			session.multiPV = user.multiPV
+			session.whitePerspective = user.whitePerspective
 		}
 		s.usersMu.Unlock()
 		conn.Close()
@@ -177,12 +523,12 @@ func (s *EngineServer) writePump(conn *websocket.Conn, user *EngineUser) {
 	for {
 		select {
 		case message := <-s.engineOutputChannel:
-			if user.subscribed {
-				conn.WriteMessage(websocket.TextMessage, []byte(message))
+			if !user.subscribed.Load() {
+				continue
 			}
+			user.write(message, engineJSONMessage{Type: "engine", Message: message})
 		case <-ticker.C:
-			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := user.ping(); err != nil {
 				return
 			}
 		}
@@ -190,6 +536,29 @@ func (s *EngineServer) writePump(conn *websocket.Conn, user *EngineUser) {
 }
 
 func (s *EngineServer) handleMessage(conn *websocket.Conn, user *EngineUser, msg string) {
+	if !user.negotiated {
+		// Only the first message can switch the connection to JSON, the text protocol stays the default
+		user.negotiated = true
+		var hello struct {
+			Protocol string `json:"protocol"`
+		}
+		if strings.HasPrefix(msg, "{") && json.Unmarshal([]byte(msg), &hello) == nil && hello.Protocol == "json" {
+			user.writeMu.Lock()
+			user.json = true
+			conn.WriteJSON(engineJSONMessage{Type: "protocol", Protocol: "json"})
+			user.writeMu.Unlock()
+			return
+		}
+	}
+	if user.json {
+		var request engineJSONRequest
+		if err := json.Unmarshal([]byte(msg), &request); err != nil {
+			user.send("error: invalid JSON message")
+			return
+		}
+		msg = request.command()
+	}
+
 	parts := strings.Fields(msg)
 	if len(parts) == 0 {
 		return
@@ -199,33 +568,72 @@ func (s *EngineServer) handleMessage(conn *websocket.Conn, user *EngineUser, msg
 
 	switch cmd {
 	case "iam":
-		conn.WriteMessage(websocket.TextMessage, []byte("auth required"))
+		user.send("auth required")
 	case "auth":
 		if len(parts) < 2 {
-			conn.WriteMessage(websocket.TextMessage, []byte("auth failed: missing passkey"))
+			user.send("auth failed: missing passkey")
 			return
 		}
-		if parts[1] == s.passKey {
+		// Checked and set together, so a passkey rotated in between can't be accepted
+		s.usersMu.Lock()
+		authenticated := parts[1] == s.passKey
+		if authenticated {
 			user.authenticated = true
-			conn.WriteMessage(websocket.TextMessage, []byte("auth success"))
+		}
+		s.usersMu.Unlock()
+		if authenticated {
+			user.send("auth success")
+			if token, err := s.issueResumeToken(user); err == nil {
+				user.sendResumeToken(token)
+			} else {
+				logger.Warnf("Could not issue a resume token: %v\n", err)
+			}
 		} else {
-			conn.WriteMessage(websocket.TextMessage, []byte("auth failed"))
+			user.send("auth failed")
+		}
+	case "resume":
+		if len(parts) < 2 {
+			user.send("error: missing resume token")
+			return
+		}
+		hadLock, err := s.resumeSession(user, parts[1])
+		if err != nil {
+			user.send("error: " + err.Error())
+			return
+		}
+		user.send("resume success")
+		if hadLock {
+			// Only given back when nobody took the lock in the meantime
+			s.engineLock.Lock()
+			relocked := s.engineOwner == nil
+			if relocked {
+				s.engineOwner = conn
+				user.hasLock = true
+			}
+			s.engineLock.Unlock()
+			if relocked {
+				s.applyMultiPV(user)
+				user.send("lock acquired")
+			} else {
+				user.send("error: engine locked by another user")
+			}
 		}
 	case "lock":
-		if !user.authenticated && s.requireAuth {
-			conn.WriteMessage(websocket.TextMessage, []byte("error: not authenticated"))
+		if s.requireAuth && !s.isAuthenticated(user) {
+			user.send("error: not authenticated")
 			return
 		}
 		s.engineLock.Lock()
 		if s.engineOwner != nil && s.engineOwner != conn {
 			s.engineLock.Unlock()
-			conn.WriteMessage(websocket.TextMessage, []byte("error: engine locked by another user"))
+			user.send("error: engine locked by another user")
 			return
 		}
 		s.engineOwner = conn
 		user.hasLock = true
 		s.engineLock.Unlock()
-		conn.WriteMessage(websocket.TextMessage, []byte("lock acquired"))
+		s.applyMultiPV(user)
+		user.send("lock acquired")
 	case "unlock":
 		s.engineLock.Lock()
 		if s.engineOwner == conn {
@@ -233,45 +641,394 @@ func (s *EngineServer) handleMessage(conn *websocket.Conn, user *EngineUser, msg
 			user.hasLock = false
 		}
 		s.engineLock.Unlock()
-		conn.WriteMessage(websocket.TextMessage, []byte("lock released"))
+		user.send("lock released")
 	case "sub":
-		user.subscribed = true
-		conn.WriteMessage(websocket.TextMessage, []byte("subscribed"))
+		user.subscribed.Store(true)
+		user.send("subscribed")
 	case "unsub":
-		user.subscribed = false
-		conn.WriteMessage(websocket.TextMessage, []byte("unsubscribed"))
+		user.subscribed.Store(false)
+		user.send("unsubscribed")
+	case "verbose":
+		if len(parts) < 2 || (parts[1] != "on" && parts[1] != "off") {
+			user.send("error: use verbose on or verbose off")
+			return
+		}
+		user.verbose = parts[1] == "on"
+		user.send("verbose " + parts[1])
+	case "perspective":
+		if len(parts) < 2 || (parts[1] != "white" && parts[1] != "side") {
+			user.send("error: use perspective white or perspective side")
+			return
+		}
+		user.whitePerspective = parts[1] == "white"
+		user.send("perspective " + parts[1])
+	case "setmultipv":
+		if !s.holdsLock(user) {
+			user.send("error: engine not locked")
+			return
+		}
+		if len(parts) < 2 {
+			user.send("error: missing multipv")
+			return
+		}
+		multiPV, err := strconv.Atoi(parts[1])
+		if err != nil || multiPV < 1 || multiPV > maxClientMultiPV {
+			user.send(fmt.Sprintf("error: multipv must be between 1 and %d", maxClientMultiPV))
+			return
+		}
+		user.multiPV = multiPV
+		if err := s.engine.SetMultiPV(multiPV); err != nil {
+			user.send("error: " + err.Error())
+			return
+		}
+		user.send(fmt.Sprintf("multipv %d", multiPV))
 	case "position":
-		if !user.hasLock {
-			conn.WriteMessage(websocket.TextMessage, []byte("error: engine not locked"))
+		if !s.holdsLock(user) {
+			user.send("error: engine not locked")
+			return
+		}
+		if user.limiter != nil && !user.limiter.Allow() {
+			user.send("error: rate limited")
+			return
+		}
+		fen, err := parsePosition(parts[1:])
+		if err != nil {
+			user.send("error: " + err.Error())
 			return
 		}
-		// Forward to engine
-		s.engineInputChannel <- msg
+		user.fen = fen
 	case "go":
-		if !user.hasLock {
-			conn.WriteMessage(websocket.TextMessage, []byte("error: engine not locked"))
+		if !s.holdsLock(user) {
+			user.send("error: engine not locked")
+			return
+		}
+		if user.limiter != nil && !user.limiter.Allow() {
+			user.send("error: rate limited")
+			return
+		}
+		if s.restarting.Load() {
+			user.send("error: engine restarting")
+			return
+		}
+		limit, clamped, err := s.parseGoLimit(parts[1:])
+		if err != nil {
+			user.send("error: " + err.Error())
 			return
 		}
-		// Parse and execute
-		if len(parts) >= 3 && parts[1] == "movetime" {
-			fen := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1" // Default starting position
-			// In real implementation, extract FEN from last "position" command
-			thinkTime := time.Duration(1000) * time.Millisecond
-			if len(parts) >= 3 {
-				var ms int
-				fmt.Sscanf(parts[2], "%d", &ms)
-				thinkTime = time.Duration(ms) * time.Millisecond
+		if clamped {
+			// Clamped rather than rejected so existing clients keep working, they're told the time used
+			user.send(fmt.Sprintf("info movetime %d clamped", limit.MoveTime.Milliseconds()))
+		}
+		fen := user.fen
+		if fen == "" {
+			fen = startFEN
+		}
+		started := time.Now()
+		analysis, err := s.engine.AnalyzeWithLimit(fen, limit)
+		if err != nil {
+			s.metrics.analysisErrors.Add(1)
+			user.send("error: " + err.Error())
+			return
+		}
+		s.metrics.analyses.Add(1)
+		s.metrics.analysisNanos.Add(int64(time.Since(started)))
+		s.metrics.tbHits.Add(analysis.TBHits)
+		if user.whitePerspective {
+			analysis = analysis.FromWhitePerspective(fen)
+		}
+		user.sendAnalysis(analysis)
+	default:
+		user.send("error: unknown command")
+	}
+}
+
+// startFEN is the standard starting position, searched when a user hasn't sent a position
+const startFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// parsePosition returns the FEN for the parameters of a position command, "startpos" or
+// "fen <fen>", either optionally followed by "moves e2e4 e7e5 ..."
+func parsePosition(params []string) (string, error) {
+	setup := params
+	var moves []string
+	for i, param := range params {
+		if param == "moves" {
+			setup, moves = params[:i], params[i+1:]
+			break
+		}
+	}
+
+	fen := startFEN
+	switch {
+	case len(setup) == 1 && setup[0] == "startpos":
+	case len(setup) > 1 && setup[0] == "fen":
+		fen = strings.Join(setup[1:], " ")
+	default:
+		return "", errors.New("use position startpos or position fen <fen>, optionally followed by moves")
+	}
+	board, err := ParseFEN(fen)
+	if err != nil {
+		return "", fmt.Errorf("invalid fen: %w", err)
+	}
+	for _, move := range moves {
+		if err := board.ApplyUCI(move); err != nil {
+			return "", err
+		}
+	}
+	return board.FEN(), nil
+}
+
+// isAuthenticated reports whether user is authenticated, RotatePasskey can revoke it at any time
+func (s *EngineServer) isAuthenticated(user *EngineUser) bool {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+	return user.authenticated
+}
+
+// holdsLock reports whether user has the engine lock, RotatePasskey can take it away at any time
+func (s *EngineServer) holdsLock(user *EngineUser) bool {
+	s.engineLock.Lock()
+	defer s.engineLock.Unlock()
+	return user.hasLock
+}
+
+// applyMultiPV sets the engine to the MultiPV the user asked for, or back to the server's default,
+// after they got the lock. A failure is only logged, the next search shows whether the engine works
+func (s *EngineServer) applyMultiPV(user *EngineUser) {
+	multiPV := s.defaultMultiPV
+	if user.multiPV > 0 {
+		multiPV = user.multiPV
+	}
+	if err := s.engine.SetMultiPV(multiPV); err != nil {
+		logger.Warnf("Could not set the engine's MultiPV to %d: %v\n", multiPV, err)
+	}
+}
+
+// issueResumeToken returns the user's resume token, creating one on their first auth. Expired
+// sessions are dropped while at it
+func (s *EngineServer) issueResumeToken(user *EngineUser) (string, error) {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+	if user.resumeToken != "" {
+		return user.resumeToken, nil
+	}
+
+	now := time.Now()
+	for token, session := range s.sessions {
+		if session.user == nil && now.After(session.expires) {
+			delete(s.sessions, token)
+		}
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	s.sessions[token] = &engineSession{user: user}
+	user.resumeToken = token
+	return token, nil
+}
+
+// resumeSession authenticates user with a resume token from a dropped connection, restoring its
+// settings, and reports whether that connection held the engine lock. A token can only be resumed
+// once its old connection is gone, and keeps working for the new one
+func (s *EngineServer) resumeSession(user *EngineUser, token string) (hadLock bool, err error) {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+
+	session, ok := s.sessions[token]
+	if !ok || (session.user == nil && time.Now().After(session.expires)) {
+		return false, errResumeFailed
+	}
+	if session.user != nil {
+		return false, errors.New("resume token is still in use by another connection")
+	}
+
+	session.user = user
+	user.authenticated = true
+	user.resumeToken = token
+	user.verbose = session.verbose
+	user.multiPV = session.multiPV
+	user.whitePerspective = session.whitePerspective
+	return session.hadLock, nil
+}
+
+// engineJSONRequest is a client message in JSON mode, e.g. {"type":"auth","key":"..."} or
+// {"type":"go","depth":20}. It is turned into the matching text command
+type engineJSONRequest struct {
+	Type        string `json:"type"`
+	Key         string `json:"key,omitempty"`         // auth
+	Token       string `json:"token,omitempty"`       // resume
+	MultiPV     int    `json:"multipv,omitempty"`     // setmultipv
+	Perspective string `json:"perspective,omitempty"` // perspective, "white" or "side"
+	FEN         string `json:"fen,omitempty"`         // position
+	Depth       int    `json:"depth,omitempty"`       // go
+	Nodes       int64  `json:"nodes,omitempty"`       // go
+	MoveTime    int    `json:"movetime,omitempty"`    // go, in milliseconds
+}
+
+// command returns the text protocol command for the request
+func (r engineJSONRequest) command() string {
+	switch r.Type {
+	case "auth":
+		return "auth " + r.Key
+	case "resume":
+		return "resume " + r.Token
+	case "setmultipv":
+		return fmt.Sprintf("setmultipv %d", r.MultiPV)
+	case "perspective":
+		return "perspective " + r.Perspective
+	case "position":
+		return "position fen " + r.FEN
+	case "go":
+		command := "go"
+		if r.Depth != 0 {
+			command += fmt.Sprintf(" depth %d", r.Depth)
+		}
+		if r.Nodes != 0 {
+			command += fmt.Sprintf(" nodes %d", r.Nodes)
+		}
+		if r.MoveTime != 0 {
+			command += fmt.Sprintf(" movetime %d", r.MoveTime)
+		}
+		return command
+	default:
+		return r.Type
+	}
+}
+
+// engineJSONMessage is a server message in JSON mode. Replies that are a line of text in the text
+// protocol are sent as {"type":"status","message":"lock acquired"}, or with type "error" for errors
+type engineJSONMessage struct {
+	Type     string   `json:"type"`
+	Message  string   `json:"message,omitempty"`
+	Protocol string   `json:"protocol,omitempty"`
+	Token    string   `json:"token,omitempty"`
+	BestMove string   `json:"bestmove,omitempty"`
+	Score    *int     `json:"score,omitempty"` // Centipawns, not set for a forced mate. From the side to move's point of view unless the user asked for White's
+	Mate     int      `json:"mate,omitempty"`
+	Eval     *float64 `json:"eval,omitempty"` // NormalizeEval of the score, 0-1 for eval bars
+	Depth    int      `json:"depth,omitempty"`
+	PV       []string `json:"pv,omitempty"`
+}
+
+// write sends text to the user, or message when the connection uses JSON. All writes to the
+// connection go through writeMu
+func (u *EngineUser) write(text string, message engineJSONMessage) error {
+	u.writeMu.Lock()
+	defer u.writeMu.Unlock()
+	if u.json {
+		return u.conn.WriteJSON(message)
+	}
+	return u.conn.WriteMessage(websocket.TextMessage, []byte(text))
+}
+
+// ping sends a websocket ping, failing when the client doesn't take it within 10 seconds
+func (u *EngineUser) ping() error {
+	u.writeMu.Lock()
+	defer u.writeMu.Unlock()
+	u.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return u.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
+// send writes a reply to the user, as text or as a JSON status or error message
+func (u *EngineUser) send(text string) {
+	if message, ok := strings.CutPrefix(text, "error: "); ok {
+		u.write(text, engineJSONMessage{Type: "error", Message: message})
+		return
+	}
+	u.write(text, engineJSONMessage{Type: "status", Message: text})
+}
+
+// sendResumeToken tells the user the token to resume with after a reconnect, as
+// "resume token <token>" or {"type":"resume","token":"..."}
+func (u *EngineUser) sendResumeToken(token string) {
+	u.write("resume token "+token, engineJSONMessage{Type: "resume", Token: token})
+}
+
+// sendAnalysis writes the result of a go command, JSON messages always carry the score and PV
+func (u *EngineUser) sendAnalysis(analysis *EngineAnalysis) {
+	message := engineJSONMessage{
+		Type:     "analysis",
+		BestMove: analysis.BestMove,
+		Mate:     analysis.Mate,
+		Depth:    analysis.Depth,
+		PV:       analysis.PV,
+	}
+	if analysis.Mate == 0 {
+		message.Score = &analysis.Score
+	}
+	eval := NormalizeEval(analysis.Score, analysis.Mate)
+	message.Eval = &eval
+	u.write(bestMoveReply(analysis, u.verbose), message)
+}
+
+// bestMoveReply formats the result of a go command. Plain replies are just "bestmove e2e4" like
+// before, verbose ones add the score, its NormalizeEval, the depth and PV, e.g.
+// "bestmove e2e4 score cp 34 eval 0.549 depth 20 pv e2e4 e7e5 g1f3", with "score mate 3" for forced mates
+func bestMoveReply(analysis *EngineAnalysis, verbose bool) string {
+	reply := "bestmove " + analysis.BestMove
+	if !verbose {
+		return reply
+	}
+	if analysis.Mate != 0 {
+		reply += fmt.Sprintf(" score mate %d", analysis.Mate)
+	} else {
+		reply += fmt.Sprintf(" score cp %d", analysis.Score)
+	}
+	reply += fmt.Sprintf(" eval %.3f depth %d", NormalizeEval(analysis.Score, analysis.Mate), analysis.Depth)
+	if len(analysis.PV) > 0 {
+		reply += " pv " + strings.Join(analysis.PV, " ")
+	}
+	return reply
+}
+
+// parseGoLimit parses the parameters of a go command, e.g. "depth 20" or "movetime 1000", any
+// combination of depth, nodes and movetime is allowed. The search is never allowed to run for
+// longer than the server's max move time, clamped reports whether a longer movetime was cut down
+func (s *EngineServer) parseGoLimit(params []string) (limit SearchLimit, clamped bool, err error) {
+	if len(params) == 0 {
+		return SearchLimit{}, false, errUnsupportedGo
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < len(params); i += 2 {
+		name := params[i]
+		if (name != "depth" && name != "nodes" && name != "movetime") || seen[name] {
+			return SearchLimit{}, false, errUnsupportedGo
+		}
+		seen[name] = true
+		if i+1 >= len(params) {
+			return SearchLimit{}, false, fmt.Errorf("missing %s", name)
+		}
+		value, err := strconv.ParseInt(params[i+1], 10, 64)
+		if err != nil || value <= 0 {
+			return SearchLimit{}, false, fmt.Errorf("invalid %s %s", name, params[i+1])
+		}
+
+		switch name {
+		case "depth":
+			if value > maxGoDepth {
+				return SearchLimit{}, false, fmt.Errorf("depth must be at most %d", maxGoDepth)
 			}
-			analysis, err := s.engine.AnalyzePosition(fen, thinkTime)
-			if err != nil {
-				conn.WriteMessage(websocket.TextMessage, []byte("error: "+err.Error()))
-				return
+			limit.Depth = int(value)
+		case "nodes":
+			if value > maxGoNodes {
+				return SearchLimit{}, false, fmt.Errorf("nodes must be at most %d", maxGoNodes)
 			}
-			conn.WriteMessage(websocket.TextMessage, []byte("bestmove "+analysis.BestMove))
+			limit.Nodes = value
+		case "movetime":
+			// Compared in milliseconds first, a huge value would overflow a Duration
+			if value > s.maxMoveTime.Milliseconds() {
+				value = s.maxMoveTime.Milliseconds()
+				clamped = true
+			}
+			limit.MoveTime = time.Duration(value) * time.Millisecond
 		}
-	default:
-		conn.WriteMessage(websocket.TextMessage, []byte("error: unknown command"))
 	}
+	if limit.MoveTime == 0 {
+		limit.MoveTime = s.maxMoveTime
+	}
+	return limit, clamped, nil
 }
 
 func isLocalhost(addr string) bool {
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeUCIEngine is a shell script speaking just enough UCI for the engine to start and search:
+// every go answers with one info line and e2e4
+const fakeUCIEngine = `#!/bin/sh
+while read -r line; do
+  case "$line" in
+    uci) echo "id name fake"; echo "uciok";;
+    isready) echo "readyok";;
+    go*) echo "info depth 12 score cp 34 nodes 100 pv e2e4 e7e5 g1f3"; echo "bestmove e2e4 ponder e7e5";;
+    quit) exit 0;;
+  esac
+done
+`
+
+// writeFakeEngine writes script to an executable file and returns its path
+func writeFakeEngine(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake engine is a shell script")
+	}
+	path := filepath.Join(t.TempDir(), "engine.sh")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSuperviseEngineRestartsKilledEngine(t *testing.T) {
+	s, err := NewEngineServer(&EngineConfig{EnginePath: writeFakeEngine(t, fakeUCIEngine), Threads: 1, Hash: 16, MultiPV: 1, Depth: 12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+	supervised := make(chan struct{})
+	go func() {
+		defer close(supervised)
+		s.superviseEngine()
+	}()
+	defer func() {
+		s.engine.Stop()
+		<-s.engine.Done()
+	}()
+
+	killed := s.engine.Done()
+	if err := s.engine.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	<-killed
+
+	deadline := time.Now().Add(minRestartBackoff + 5*time.Second)
+	for s.metrics.engineRestarts.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the killed engine wasn't restarted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.restarting.Load() {
+		t.Error("still marked as restarting after the restart")
+	}
+	if !s.engine.IsHealthy(time.Second) {
+		t.Fatal("the restarted engine isn't healthy")
+	}
+	analysis, err := s.engine.AnalyzeWithLimit("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", SearchLimit{Depth: 12})
+	if err != nil {
+		t.Fatalf("analysis after the restart failed: %v", err)
+	}
+	if analysis.BestMove != "e2e4" {
+		t.Errorf("best move after the restart = %q, want e2e4", analysis.BestMove)
+	}
+
+	// Stopping on purpose ends the supervision instead of restarting again
+	s.engine.Stop()
+	select {
+	case <-supervised:
+	case <-time.After(5 * time.Second):
+		t.Fatal("superviseEngine kept running after Stop")
+	}
+	if restarts := s.metrics.engineRestarts.Load(); restarts != 1 {
+		t.Errorf("engine restarted %d times, want 1", restarts)
+	}
+}
+
+func TestBestMoveReplyEvalsTheBestLine(t *testing.T) {
+	// The worse lines come last, the eval must still be the best line's
+	analysis, err := engineWithOutput(`info depth 2 multipv 1 score cp 34 pv e2e4 e7e5
+info depth 2 multipv 2 score cp -250 pv g1h3 e7e5
+info depth 2 multipv 3 score mate -4 pv f2f3 e7e5
+bestmove e2e4 ponder e7e5
+`).readSearch(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "bestmove e2e4 score cp 34 eval 0.549 depth 2 pv e2e4 e7e5"
+	if got := bestMoveReply(analysis, true); got != want {
+		t.Errorf("bestMoveReply = %q, want %q", got, want)
+	}
+	if got := bestMoveReply(analysis, false); got != "bestmove e2e4" {
+		t.Errorf("plain bestMoveReply = %q, want %q", got, "bestmove e2e4")
+	}
+}
+
+// dialEngineServer connects a client to the server's websocket handler and reads its greeting
+func dialEngineServer(t *testing.T, s *EngineServer) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(s.handleWebSocket))
+	t.Cleanup(server.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	expectMessage(t, conn, "whoareyou")
+	return conn
+}
+
+// expectMessage reads the next text message and fails unless it starts with want
+func expectMessage(t *testing.T, conn *websocket.Conn, want string) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("waiting for %q: %v", want, err)
+	}
+	if !strings.HasPrefix(string(message), want) {
+		t.Fatalf("got %q, want %q", message, want)
+	}
+	return string(message)
+}
+
+func sendMessage(t *testing.T, conn *websocket.Conn, message string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestRotatePasskeyWhileConnected rotates the passkey while a client keeps sending commands, run
+// it with -race to check the connection's state and writes are synchronized
+func TestRotatePasskeyWhileConnected(t *testing.T) {
+	s, err := NewEngineServer(&EngineConfig{EnginePath: "unused", RequireAuth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := dialEngineServer(t, s)
+
+	sendMessage(t, conn, "auth "+s.PassKey())
+	expectMessage(t, conn, "auth success")
+	expectMessage(t, conn, "resume token ")
+	sendMessage(t, conn, "lock")
+	expectMessage(t, conn, "lock acquired")
+
+	const commands = 50
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for range commands {
+			conn.WriteMessage(websocket.TextMessage, []byte("verbose on"))
+		}
+	}()
+	if _, err := s.RotatePasskey(); err != nil {
+		t.Fatal(err)
+	}
+	<-sent
+
+	replies, rotated := 0, false
+	for replies < commands || !rotated {
+		switch message := expectMessage(t, conn, ""); message {
+		case "verbose on":
+			replies++
+		case "auth required: passkey rotated":
+			rotated = true
+		default:
+			t.Fatalf("unexpected message %q", message)
+		}
+	}
+
+	sendMessage(t, conn, "position startpos")
+	expectMessage(t, conn, "error: engine not locked")
+	sendMessage(t, conn, "lock")
+	expectMessage(t, conn, "error: not authenticated")
+	sendMessage(t, conn, "auth "+s.PassKey())
+	expectMessage(t, conn, "auth success")
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// engineWithOutput returns an engine reading output as if its process had printed it
+func engineWithOutput(output string) *ChessEngine {
+	e := &ChessEngine{}
+	e.stdout = readEngineOutput(strings.NewReader(output), nil)
+	return e
+}
+
+func TestReadSearch(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   EngineAnalysis
+	}{
+		{
+			name: "single pv",
+			output: `info depth 1 score cp 20 nodes 20 pv e2e4
+info depth 2 score cp 34 nodes 100 time 5 pv e2e4 e7e5
+bestmove e2e4 ponder e7e5
+`,
+			want: EngineAnalysis{BestMove: "e2e4", Score: 34, Depth: 2, Nodes: 100, Time: 5, PV: []string{"e2e4", "e7e5"}, PonderMove: "e7e5", Variations: []EngineVariation{}},
+		},
+		{
+			name: "mate",
+			output: `info depth 5 score cp 900 pv d1h5
+info depth 6 score mate 2 pv d1h5 g8f6 h5f7
+bestmove d1h5
+`,
+			want: EngineAnalysis{BestMove: "d1h5", Depth: 6, Mate: 2, PV: []string{"d1h5", "g8f6", "h5f7"}, Variations: []EngineVariation{}},
+		},
+		{
+			name: "multipv",
+			output: `info depth 1 multipv 1 score cp 20 nodes 20 pv e2e4
+info depth 1 multipv 2 score cp 10 nodes 40 pv d2d4
+info depth 2 multipv 1 score cp 34 nodes 100 pv e2e4 e7e5
+info depth 2 multipv 2 score cp 25 nodes 150 pv d2d4 d7d5
+info depth 2 multipv 3 score cp -150 nodes 200 time 7 pv f2f3 e7e5
+bestmove e2e4 ponder e7e5
+`,
+			want: EngineAnalysis{
+				BestMove: "e2e4", Score: 34, Depth: 2, Nodes: 200, Time: 7, PV: []string{"e2e4", "e7e5"}, PonderMove: "e7e5",
+				Variations: []EngineVariation{
+					{Move: "d2d4", Score: 25, PV: []string{"d2d4", "d7d5"}},
+					{Move: "f2f3", Score: -150, PV: []string{"f2f3", "e7e5"}},
+				},
+			},
+		},
+		{
+			name: "multipv lines out of order",
+			output: `info depth 3 multipv 3 score cp -40 pv a2a3
+info depth 3 multipv 1 score cp 30 pv e2e4
+info depth 3 multipv 2 score cp 12 pv c2c4
+bestmove e2e4
+`,
+			want: EngineAnalysis{
+				BestMove: "e2e4", Score: 30, Depth: 3, PV: []string{"e2e4"},
+				Variations: []EngineVariation{
+					{Move: "c2c4", Score: 12, PV: []string{"c2c4"}},
+					{Move: "a2a3", Score: -40, PV: []string{"a2a3"}},
+				},
+			},
+		},
+		{
+			name: "multipv mates",
+			output: `info depth 8 multipv 1 score mate 2 pv d1h5 g8f6 h5f7
+info depth 8 multipv 2 score cp 150 pv f1c4
+info depth 8 multipv 3 score mate -1 pv g2g4 d8h4
+bestmove d1h5
+`,
+			want: EngineAnalysis{
+				BestMove: "d1h5", Depth: 8, Mate: 2, PV: []string{"d1h5", "g8f6", "h5f7"},
+				Variations: []EngineVariation{
+					{Move: "f1c4", Score: 150, PV: []string{"f1c4"}},
+					{Move: "g2g4", Mate: -1, PV: []string{"g2g4", "d8h4"}},
+				},
+			},
+		},
+		{
+			name: "currmove lines keep the score",
+			output: `info depth 4 multipv 1 score cp 50 pv g1f3
+info depth 5 currmove b1c3 currmovenumber 3
+bestmove g1f3
+`,
+			want: EngineAnalysis{BestMove: "g1f3", Score: 50, Depth: 5, PV: []string{"g1f3"}, Variations: []EngineVariation{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := engineWithOutput(tt.output).readSearch(nil)
+			if err != nil {
+				t.Fatalf("readSearch error: %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("readSearch =\n%+v\nwant\n%+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSearchEngineExited(t *testing.T) {
+	e := engineWithOutput("info depth 1 multipv 1 score cp 20 pv e2e4\n")
+	e.ready.Store(true)
+	if _, err := e.readSearch(nil); err == nil {
+		t.Fatal("readSearch without a bestmove succeeded, want an error")
+	}
+	if e.ready.Load() {
+		t.Error("engine still marked ready after its output ended")
+	}
+}
+
+func TestNormalizeEval(t *testing.T) {
+	tests := []struct {
+		name   string
+		cp     int
+		mateIn int
+		want   float64
+	}{
+		{name: "equal", cp: 0, want: 0.5},
+		{name: "one pawn up", cp: 100, want: 0.640},
+		{name: "one pawn down", cp: -100, want: 0.360},
+		{name: "four pawns up", cp: 400, want: 10.0 / 11},
+		{name: "ten pawns up", cp: 1000, want: 0.997},
+		{name: "ten pawns down", cp: -1000, want: 0.003},
+		{name: "mate score in cp", cp: mateScoreCp, want: 1},
+		{name: "mated score in cp", cp: -mateScoreCp, want: 0},
+		{name: "mate in one", mateIn: 1, want: 1},
+		{name: "mate in twenty", mateIn: 20, want: 1},
+		{name: "mated in one", mateIn: -1, want: 0},
+		{name: "mate ignores cp", cp: -500, mateIn: 3, want: 1},
+		{name: "mated ignores cp", cp: 500, mateIn: -3, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeEval(tt.cp, tt.mateIn)
+			if math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("NormalizeEval(%d, %d) = %.4f, want %.4f", tt.cp, tt.mateIn, got, tt.want)
+			}
+			if got < 0 || got > 1 {
+				t.Errorf("NormalizeEval(%d, %d) = %v, outside 0-1", tt.cp, tt.mateIn, got)
+			}
+		})
+	}
+}
+
+func TestNormalizeEvalIsMonotonic(t *testing.T) {
+	previous := NormalizeEval(-3000, 0)
+	for cp := -2990; cp <= 3000; cp += 10 {
+		got := NormalizeEval(cp, 0)
+		if got < previous {
+			t.Fatalf("NormalizeEval(%d, 0) = %v, below NormalizeEval(%d, 0) = %v", cp, got, cp-10, previous)
+		}
+		previous = got
+	}
+}
+
+func TestFromWhitePerspective(t *testing.T) {
+	analysis := &EngineAnalysis{
+		BestMove: "d8h4",
+		Score:    120,
+		Mate:     1,
+		Variations: []EngineVariation{
+			{Move: "e7e5", Score: 35},
+			{Move: "g7g5", Mate: -2},
+		},
+	}
+
+	// White to move, the scores already are from White's point of view
+	white := analysis.FromWhitePerspective("rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR w KQkq - 0 3")
+	if !reflect.DeepEqual(white, analysis) {
+		t.Errorf("with White to move = %+v, want it unchanged", white)
+	}
+
+	black := analysis.FromWhitePerspective("rnbqkbnr/pppppppp/8/8/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq - 0 2")
+	want := &EngineAnalysis{
+		BestMove: "d8h4",
+		Score:    -120,
+		Mate:     -1,
+		Variations: []EngineVariation{
+			{Move: "e7e5", Score: -35},
+			{Move: "g7g5", Mate: 2},
+		},
+	}
+	if !reflect.DeepEqual(black, want) {
+		t.Errorf("with Black to move =\n%+v\nwant\n%+v", black, want)
+	}
+	// The original is left as it was
+	if analysis.Score != 120 || analysis.Variations[1].Mate != -2 {
+		t.Errorf("FromWhitePerspective changed the original analysis: %+v", analysis)
+	}
+}
+
+func TestStartFailsWhenEngineExits(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"before uciok", "#!/bin/sh\nread -r line\necho 'id name broken'\n", "uciok"},
+		{"before readyok", "#!/bin/sh\nread -r line\necho uciok\nread -r line\n", "readyok"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewChessEngine(writeFakeEngine(t, tt.script), 1, 16, 1, 1)
+			err := e.Start()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Start() = %v, want an error about %s", err, tt.want)
+			}
+			select {
+			case <-e.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("Done wasn't closed after the engine exited")
+			}
+			if e.Running() {
+				t.Error("Running() = true after a failed start")
+			}
+		})
+	}
+}
+
+func TestIsHealthyUnlocksOnTimeout(t *testing.T) {
+	// Answers the isready of Start and then never again
+	e := NewChessEngine(writeFakeEngine(t, `#!/bin/sh
+answered=0
+while read -r line; do
+  case "$line" in
+    uci) echo "uciok";;
+    isready) if [ $answered = 0 ]; then echo "readyok"; answered=1; fi;;
+    quit) exit 0;;
+  esac
+done
+`), 1, 16, 1, 1)
+	if err := e.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop()
+
+	if e.IsHealthy(100 * time.Millisecond) {
+		t.Fatal("IsHealthy() = true for an engine that doesn't answer")
+	}
+	if !e.mu.TryLock() {
+		t.Fatal("the engine is still locked after the health check timed out")
+	}
+	e.mu.Unlock()
+}
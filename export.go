@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AccountExport is the read-only view of an account written by `accounts export`
+type AccountExport struct {
+	Username      string         `json:"username"`
+	IsPremium     bool           `json:"is_premium"`
+	PremiumExpiry time.Time      `json:"premium_expiry"`
+	StrategyName  string         `json:"strategy_name"`
+	LastRun       time.Time      `json:"last_run"`
+	LastRating    int            `json:"last_rating"`
+	DailySolves   map[string]int `json:"daily_solves,omitempty"` // Date (YYYY-MM-DD) to puzzles solved
+}
+
+// buildAccountExports converts accounts to their export form, sorted by username
+func buildAccountExports(db *Database, history []HistoryEntry, includeDaily bool) []AccountExport {
+	exports := make([]AccountExport, 0, len(db.Accounts))
+	for _, account := range db.Accounts {
+		export := AccountExport{
+			Username:      account.Username,
+			IsPremium:     account.IsPremium,
+			PremiumExpiry: account.PremiumExpiry,
+			StrategyName:  account.StrategyName,
+			LastRun:       account.LastRun,
+			LastRating:    account.LastRating,
+		}
+		if includeDaily {
+			export.DailySolves = make(map[string]int)
+			for _, entry := range history {
+				if historyEntryBelongsTo(entry, &account) {
+					export.DailySolves[entry.Timestamp.Format(time.DateOnly)]++
+				}
+			}
+		}
+		exports = append(exports, export)
+	}
+
+	sort.Slice(exports, func(i, j int) bool {
+		return exports[i].Username < exports[j].Username
+	})
+
+	return exports
+}
+
+func writeAccountsJSON(w io.Writer, exports []AccountExport) error {
+	data, err := json.MarshalIndent(exports, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeAccountsCSV writes one row per account, or one row per account and day when daily solves are included
+func writeAccountsCSV(w io.Writer, exports []AccountExport, includeDaily bool) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"username", "is_premium", "premium_expiry", "strategy_name", "last_run", "last_rating"}
+	if includeDaily {
+		header = append(header, "date", "puzzles_solved")
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		row := []string{
+			export.Username,
+			strconv.FormatBool(export.IsPremium),
+			formatExportTime(export.PremiumExpiry),
+			export.StrategyName,
+			formatExportTime(export.LastRun),
+			strconv.Itoa(export.LastRating),
+		}
+
+		if !includeDaily || len(export.DailySolves) == 0 {
+			if includeDaily {
+				row = append(row, "", "0")
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+			continue
+		}
+
+		days := make([]string, 0, len(export.DailySolves))
+		for day := range export.DailySolves {
+			days = append(days, day)
+		}
+		sort.Strings(days)
+		for _, day := range days {
+			dayRow := append(append([]string{}, row...), day, strconv.Itoa(export.DailySolves[day]))
+			if err := writer.Write(dayRow); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func writeAccountsExport(w io.Writer, format string, exports []AccountExport, includeDaily bool) error {
+	switch format {
+	case "json":
+		return writeAccountsJSON(w, exports)
+	case "csv":
+		return writeAccountsCSV(w, exports, includeDaily)
+	default:
+		return fmt.Errorf("unknown export format '%s', expected csv or json", format)
+	}
+}
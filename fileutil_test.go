@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new content"), 0600); err != nil {
+		t.Fatalf("writeFileAtomic error: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "new content" {
+		t.Errorf("content = %q, want %q", got, "new content")
+	}
+	assertOnlyFile(t, path)
+}
+
+func TestWriteAtomicPartialWriteKeepsOriginal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	original := `{"schema_version":2,"accounts":{}}`
+	if err := os.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	errDiskFull := errors.New("no space left on device")
+	err := writeAtomic(path, 0600, func(w io.Writer) error {
+		// Half of the new content makes it to disk before the write fails
+		if _, err := io.WriteString(w, `{"schema_version":3,"acc`); err != nil {
+			return err
+		}
+		return errDiskFull
+	})
+	if !errors.Is(err, errDiskFull) {
+		t.Fatalf("writeAtomic error = %v, want %v", err, errDiskFull)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != original {
+		t.Errorf("content after the failed write = %q, want the original %q", got, original)
+	}
+	assertOnlyFile(t, path)
+}
+
+// assertOnlyFile fails when anything but path, like a leftover temporary file, is in its directory
+func assertOnlyFile(t *testing.T, path string) {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != filepath.Base(path) {
+			t.Errorf("unexpected file %s next to %s", entry.Name(), filepath.Base(path))
+		}
+	}
+}
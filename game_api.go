@@ -3,32 +3,65 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	cometdURL   = "wss://live.chess.com/cometd"
+	startingFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+)
+
 // GameClient represents a WebSocket client for chess.com live games
 type GameClient struct {
 	conn           *websocket.Conn
+	writeMu        sync.Mutex
 	cookie         string
+	username       string
+	proxy          string // The account's proxy URL, empty to use the environment's
+	clientID       string
+	messageID      atomic.Int64
 	gameID         string
 	myColor        string
 	currentFEN     string
 	isMyTurn       bool
+	ply            int
+	status         string
+	drawOffered    bool
+	clocks         [2]time.Duration // Remaining time for white and black as of clockUpdated
+	clockUpdated   time.Time
+	increment      time.Duration
+	baseTime       time.Duration
+	opponent       string
+	resultCode     string // chess.com's result code for us once the game is over
 	moveChannel    chan string
 	positionUpdate chan GamePosition
+	gameStarted    chan GameInfo
 	stopChan       chan bool
+	stopOnce       sync.Once
 	mu             sync.RWMutex
 }
 
 // GamePosition represents the current state of a game
 type GamePosition struct {
-	FEN      string
-	MyColor  string
-	IsMyTurn bool
-	GameID   string
+	FEN         string
+	MyColor     string
+	IsMyTurn    bool
+	GameID      string
+	Ply         int
+	GameOver    bool
+	DrawOffered bool // The opponent has a pending draw offer
+	// Remaining clock times, zero when the server hasn't sent any. The side to move's clock has
+	// the time elapsed since the last update taken off
+	MyTime       time.Duration
+	OpponentTime time.Duration
+	Increment    time.Duration
 }
 
 // GameMove represents a move in a game
@@ -37,63 +70,369 @@ type GameMove struct {
 	To   string `json:"to"`
 }
 
-// NewGameClient creates a new game client
-func NewGameClient(cookie string) *GameClient {
+// bayeuxMessage is a single message of the CometD (Bayeux) protocol used by live.chess.com
+type bayeuxMessage struct {
+	Channel                  string          `json:"channel"`
+	ID                       string          `json:"id,omitempty"`
+	ClientID                 string          `json:"clientId,omitempty"`
+	Version                  string          `json:"version,omitempty"`
+	MinimumVersion           string          `json:"minimumVersion,omitempty"`
+	SupportedConnectionTypes []string        `json:"supportedConnectionTypes,omitempty"`
+	ConnectionType           string          `json:"connectionType,omitempty"`
+	Subscription             string          `json:"subscription,omitempty"`
+	Successful               bool            `json:"successful,omitempty"`
+	Error                    string          `json:"error,omitempty"`
+	Advice                   *bayeuxAdvice   `json:"advice,omitempty"`
+	Data                     json.RawMessage `json:"data,omitempty"`
+}
+
+type bayeuxAdvice struct {
+	Reconnect string `json:"reconnect,omitempty"`
+	Interval  int    `json:"interval,omitempty"`
+	Timeout   int    `json:"timeout,omitempty"`
+}
+
+// liveGameMessage is the data of a message published on a /game/<id> channel
+type liveGameMessage struct {
+	TID  string    `json:"tid"`
+	Game *liveGame `json:"game"`
+}
+
+type liveGame struct {
+	ID        json.RawMessage `json:"id"` // Sent as a number or a string
+	Status    string          `json:"status"`
+	Moves     string          `json:"moves"` // TCN, two characters per ply
+	FEN       string          `json:"fen"`
+	Seq       int             `json:"seq"`
+	DrawOffer string          `json:"drawOffer"` // UID of the player offering a draw, if any
+	// Remaining time of white and black, and the increment, in tenths of a second
+	Clocks        []int `json:"clocks"`
+	TimeIncrement int   `json:"timeIncrement"`
+	BaseTime      int   `json:"baseTime"`
+	// Result codes of white and black once the game is over, e.g. "win" and "resigned"
+	Results []string `json:"results"`
+	Players []struct {
+		UID string `json:"uid"`
+	} `json:"players"`
+}
+
+// NewGameClient creates a new game client for the account, connecting through its proxy when it has one
+func NewGameClient(account *Account) *GameClient {
 	return &GameClient{
-		cookie:         cookie,
+		cookie:         account.Cookie,
+		username:       account.Username,
+		proxy:          account.Proxy,
 		moveChannel:    make(chan string, 10),
 		positionUpdate: make(chan GamePosition, 10),
+		gameStarted:    make(chan GameInfo, 1),
 		stopChan:       make(chan bool),
 	}
 }
 
-// ConnectToGame connects to a chess.com live game via WebSocket
+// ConnectToGame connects to live.chess.com, performs the CometD handshake and subscribes to the game channel
 func (gc *GameClient) ConnectToGame(gameID string) error {
 	gc.mu.Lock()
 	gc.gameID = gameID
 	gc.mu.Unlock()
-	
-	// Note: This is a placeholder implementation
-	// In reality, you would need to:
-	// 1. Connect to wss://live.chess.com/cometd
-	// 2. Handle CometD protocol handshake
-	// 3. Subscribe to the game channel
-	// 4. Parse game state updates
-	
-	// For now, return an error indicating this needs implementation
-	return fmt.Errorf("live game WebSocket connection not yet implemented - requires reverse engineering chess.com's CometD protocol")
-}
-
-// SendMove sends a move to the game via WebSocket
-func (gc *GameClient) SendMove(move string) error {
+
+	if err := gc.connect(); err != nil {
+		return err
+	}
+	if err := gc.publish(bayeuxMessage{Channel: "/meta/subscribe", Subscription: gc.gameChannel()}); err != nil {
+		gc.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Seek posts a live game seek and waits up to timeout for an opponent to accept it
+func (gc *GameClient) Seek(seek GameSeekRequest, timeout time.Duration) (*GameInfo, error) {
+	baseSec, incSec, err := parseTimeControl(seek.TimeControl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gc.connect(); err != nil {
+		return nil, err
+	}
+	if err := gc.publish(bayeuxMessage{Channel: "/meta/subscribe", Subscription: gc.userChannel()}); err != nil {
+		return nil, err
+	}
+
+	challenge := map[string]interface{}{
+		"tid":       "Challenge",
+		"from":      gc.username,
+		"to":        nil,
+		"gametype":  "chess",
+		"basetime":  baseSec * 10, // Tenths of a second
+		"timeinc":   incSec * 10,
+		"rated":     true,
+		"minrating": nil,
+		"maxrating": nil,
+		"color":     nil,
+	}
+	if seek.RatingMin > 0 {
+		challenge["minrating"] = seek.RatingMin
+	}
+	if seek.RatingMax > 0 {
+		challenge["maxrating"] = seek.RatingMax
+	}
+	switch strings.ToLower(seek.Color) {
+	case "white":
+		challenge["color"] = 1
+	case "black":
+		challenge["color"] = 2
+	}
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if err := gc.publish(bayeuxMessage{Channel: "/service/user", Data: data}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case game := <-gc.gameStarted:
+		game.TimeControl = seek.TimeControl
+		return &game, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("no opponent accepted the %s seek within %s", seek.TimeControl, timeout)
+	case <-gc.stopChan:
+		return nil, fmt.Errorf("connection closed while waiting for an opponent")
+	}
+}
+
+// connect opens the WebSocket, performs the CometD handshake and starts the connect loop
+func (gc *GameClient) connect() error {
+	header := http.Header{}
+	header.Set("Cookie", gc.cookie)
+	header.Set("Origin", "https://www.chess.com")
+	header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36")
+
+	proxy, err := accountProxy(&Account{Username: gc.username, Proxy: gc.proxy})
+	if err != nil {
+		return err
+	}
+	dialer := websocket.Dialer{
+		Proxy:            proxy,
+		HandshakeTimeout: 15 * time.Second,
+	}
+	conn, resp, err := dialer.Dial(cometdURL, header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("failed to connect to %s: %s", cometdURL, resp.Status)
+		}
+		return fmt.Errorf("failed to connect to %s: %w", cometdURL, err)
+	}
+
+	gc.mu.Lock()
+	gc.conn = conn
+	gc.mu.Unlock()
+
+	if err := gc.handshake(); err != nil {
+		gc.Close()
+		return err
+	}
+
+	go gc.readPump()
+
+	// The server holds each connect until it has something to deliver, readPump sends the next one
+	if err := gc.sendConnect(); err != nil {
+		gc.Close()
+		return err
+	}
+
+	return nil
+}
+
+// handshake performs the Bayeux /meta/handshake and stores the assigned client ID
+func (gc *GameClient) handshake() error {
+	err := gc.publish(bayeuxMessage{
+		Channel:                  "/meta/handshake",
+		Version:                  "1.0",
+		MinimumVersion:           "1.0",
+		SupportedConnectionTypes: []string{"websocket"},
+	})
+	if err != nil {
+		return err
+	}
+
+	gc.conn.SetReadDeadline(time.Now().Add(15 * time.Second))
+	defer gc.conn.SetReadDeadline(time.Time{})
+
+	for {
+		var messages []bayeuxMessage
+		if err := gc.conn.ReadJSON(&messages); err != nil {
+			return fmt.Errorf("failed to read handshake response: %w", err)
+		}
+		for _, msg := range messages {
+			if msg.Channel != "/meta/handshake" {
+				continue
+			}
+			if !msg.Successful {
+				return fmt.Errorf("cometd handshake rejected: %s", msg.Error)
+			}
+			gc.mu.Lock()
+			gc.clientID = msg.ClientID
+			gc.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+func (gc *GameClient) sendConnect() error {
+	return gc.publish(bayeuxMessage{Channel: "/meta/connect", ConnectionType: "websocket"})
+}
+
+// publish sends a single Bayeux message, filling in the message and client IDs
+func (gc *GameClient) publish(msg bayeuxMessage) error {
 	gc.mu.RLock()
-	defer gc.mu.RUnlock()
-	
-	if gc.conn == nil {
+	conn := gc.conn
+	msg.ClientID = gc.clientID
+	gc.mu.RUnlock()
+
+	if conn == nil {
 		return fmt.Errorf("not connected to game")
 	}
-	
-	// Note: This is a placeholder
-	// Would need to format move according to chess.com's protocol
-	moveData := map[string]interface{}{
-		"move":   move,
-		"gameId": gc.gameID,
+	msg.ID = strconv.FormatInt(gc.messageID.Add(1), 10)
+
+	gc.writeMu.Lock()
+	defer gc.writeMu.Unlock()
+	return conn.WriteJSON([]bayeuxMessage{msg})
+}
+
+func (gc *GameClient) userChannel() string {
+	return "/user/" + strings.ToLower(gc.username)
+}
+
+func (gc *GameClient) gameChannel() string {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+	return "/game/" + gc.gameID
+}
+
+// SendMove sends a move, already in chess.com's encoding, to the game
+func (gc *GameClient) SendMove(move string) error {
+	gc.mu.Lock()
+	data, err := json.Marshal(map[string]interface{}{
+		"move": map[string]interface{}{
+			"gid":  gc.gameID,
+			"move": move,
+			"seq":  gc.ply,
+			"uid":  gc.username,
+		},
+		"sid": "gserv",
+		"tid": "Move",
+	})
+	// The server echoes the move back, until then it's the opponent's turn
+	gc.isMyTurn = false
+	gc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return gc.publish(bayeuxMessage{Channel: "/service/game", Data: data})
+}
+
+// Resign resigns the game
+func (gc *GameClient) Resign() error {
+	return gc.sendGameAction("Resign")
+}
+
+// AcceptDraw accepts the opponent's pending draw offer
+func (gc *GameClient) AcceptDraw() error {
+	return gc.sendGameAction("AcceptDraw")
+}
+
+// DeclineDraw declines the opponent's pending draw offer
+func (gc *GameClient) DeclineDraw() error {
+	return gc.sendGameAction("DeclineDraw")
+}
+
+// sendGameAction publishes a move-less game message such as a resignation
+func (gc *GameClient) sendGameAction(tid string) error {
+	gc.mu.Lock()
+	data, err := json.Marshal(map[string]interface{}{
+		"gid": gc.gameID,
+		"uid": gc.username,
+		"sid": "gserv",
+		"tid": tid,
+	})
+	gc.drawOffered = false
+	gc.mu.Unlock()
+	if err != nil {
+		return err
 	}
-	
-	return gc.conn.WriteJSON(moveData)
+
+	return gc.publish(bayeuxMessage{Channel: "/service/game", Data: data})
+}
+
+// SetPosition replaces the current position, e.g. with a freshly fetched game state
+func (gc *GameClient) SetPosition(fen string) {
+	if fen == "" {
+		return
+	}
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	gc.currentFEN = fen
 }
 
 // GetCurrentPosition returns the current game position
 func (gc *GameClient) GetCurrentPosition() GamePosition {
 	gc.mu.RLock()
 	defer gc.mu.RUnlock()
-	
-	return GamePosition{
-		FEN:      gc.currentFEN,
-		MyColor:  gc.myColor,
-		IsMyTurn: gc.isMyTurn,
+
+	return gc.positionLocked()
+}
+
+func (gc *GameClient) positionLocked() GamePosition {
+	position := GamePosition{
+		FEN:         gc.currentFEN,
+		MyColor:     gc.myColor,
+		IsMyTurn:    gc.isMyTurn,
+		GameID:      gc.gameID,
+		Ply:         gc.ply,
+		GameOver:    gc.status != "" && gc.status != "in_progress" && gc.status != "starting",
+		DrawOffered: gc.drawOffered,
+		Increment:   gc.increment,
+	}
+
+	if gc.myColor != "" && !gc.clockUpdated.IsZero() {
+		clocks := gc.clocks
+		toMove := gc.ply % 2
+		if !position.GameOver {
+			clocks[toMove] -= time.Since(gc.clockUpdated)
+			if clocks[toMove] < 0 {
+				clocks[toMove] = 0
+			}
+		}
+		if gc.myColor == "white" {
+			position.MyTime, position.OpponentTime = clocks[0], clocks[1]
+		} else {
+			position.MyTime, position.OpponentTime = clocks[1], clocks[0]
+		}
+	}
+
+	return position
+}
+
+// Result summarizes the game so far, the outcome is only set once the server reports a result
+func (gc *GameClient) Result() GameResult {
+	gc.mu.RLock()
+	defer gc.mu.RUnlock()
+
+	result := GameResult{
 		GameID:   gc.gameID,
+		Opponent: gc.opponent,
+		Outcome:  gameOutcome(gc.resultCode),
+		Reason:   gc.resultCode,
+		Moves:    (gc.ply + 1) / 2,
+	}
+	if gc.baseTime > 0 {
+		result.TimeControl = fmt.Sprintf("%s+%d", strconv.FormatFloat(gc.baseTime.Minutes(), 'f', -1, 64), int(gc.increment.Seconds()))
 	}
+	return result
 }
 
 // WaitForMove waits for a move update with timeout
@@ -110,15 +449,19 @@ func (gc *GameClient) WaitForMove(timeout time.Duration) (string, error) {
 
 // Close closes the game client connection
 func (gc *GameClient) Close() error {
-	gc.mu.Lock()
-	defer gc.mu.Unlock()
-	
-	close(gc.stopChan)
-	
-	if gc.conn != nil {
-		return gc.conn.Close()
-	}
-	return nil
+	var err error
+	gc.stopOnce.Do(func() {
+		close(gc.stopChan)
+
+		gc.mu.Lock()
+		conn := gc.conn
+		gc.mu.Unlock()
+		if conn != nil {
+			gc.publish(bayeuxMessage{Channel: "/meta/disconnect"})
+			err = conn.Close()
+		}
+	})
+	return err
 }
 
 // readPump reads messages from the WebSocket connection
@@ -126,51 +469,160 @@ func (gc *GameClient) readPump() {
 	defer func() {
 		gc.Close()
 	}()
-	
+
 	for {
-		select {
-		case <-gc.stopChan:
+		var messages []bayeuxMessage
+		if err := gc.conn.ReadJSON(&messages); err != nil {
+			select {
+			case <-gc.stopChan:
+			default:
+				logger.Errorf("Error reading message: %v\n", err)
+			}
 			return
-		default:
-			_, message, err := gc.conn.ReadMessage()
-			if err != nil {
-				logger.Printf("Error reading message: %v\n", err)
+		}
+
+		for _, msg := range messages {
+			if !gc.handleMessage(msg) {
 				return
 			}
-			
-			// Parse game state update
-			var update map[string]interface{}
-			if err := json.Unmarshal(message, &update); err != nil {
-				logger.Printf("Error parsing message: %v\n", err)
-				continue
+		}
+	}
+}
+
+// handleMessage dispatches a Bayeux message, returning false when the connection should be dropped
+func (gc *GameClient) handleMessage(msg bayeuxMessage) bool {
+	switch {
+	case msg.Channel == "/meta/connect":
+		if !msg.Successful {
+			logger.Errorf("CometD connect failed: %s\n", msg.Error)
+			if msg.Advice == nil || msg.Advice.Reconnect != "retry" {
+				return false
 			}
-			
-			// Update game state
-			gc.handleGameUpdate(update)
 		}
+		if err := gc.sendConnect(); err != nil {
+			logger.Errorf("Error sending CometD connect: %v\n", err)
+			return false
+		}
+	case msg.Channel == "/meta/subscribe":
+		if !msg.Successful {
+			logger.Errorf("Failed to subscribe to %s: %s\n", msg.Subscription, msg.Error)
+			return false
+		}
+	case strings.HasPrefix(msg.Channel, "/meta/"):
+	case msg.Channel == gc.gameChannel():
+		gc.handleGameUpdate(msg.Data)
+	case msg.Channel == gc.userChannel():
+		gc.handleUserMessage(msg.Data)
+	}
+	return true
+}
+
+// handleUserMessage watches the user channel for the start of a game, which is how seeks get answered
+func (gc *GameClient) handleUserMessage(data json.RawMessage) {
+	var update liveGameMessage
+	if err := json.Unmarshal(data, &update); err != nil || update.Game == nil || len(update.Game.Players) != 2 {
+		return
+	}
+	game := update.Game
+	if game.Status != "starting" && game.Status != "in_progress" {
+		return
+	}
+
+	info := GameInfo{
+		GameID:      strings.Trim(string(game.ID), `"`),
+		WhitePlayer: game.Players[0].UID,
+		BlackPlayer: game.Players[1].UID,
+	}
+	info.GameURL = "https://www.chess.com/game/live/" + info.GameID
+
+	select {
+	case gc.gameStarted <- info:
+	default:
 	}
 }
 
 // handleGameUpdate handles a game state update from the server
-func (gc *GameClient) handleGameUpdate(update map[string]interface{}) {
+func (gc *GameClient) handleGameUpdate(data json.RawMessage) {
+	var update liveGameMessage
+	if err := json.Unmarshal(data, &update); err != nil {
+		logger.Errorf("Error parsing game update: %v\n", err)
+		return
+	}
+	if update.Game == nil {
+		return
+	}
+	game := update.Game
+
 	gc.mu.Lock()
-	defer gc.mu.Unlock()
-	
-	// Note: This would need to be implemented based on
-	// the actual chess.com WebSocket protocol
-	
-	// Example placeholder logic:
-	if fen, ok := update["fen"].(string); ok {
+	if len(game.Players) == 2 {
+		switch {
+		case strings.EqualFold(game.Players[0].UID, gc.username):
+			gc.myColor = "white"
+			gc.opponent = game.Players[1].UID
+		case strings.EqualFold(game.Players[1].UID, gc.username):
+			gc.myColor = "black"
+			gc.opponent = game.Players[0].UID
+		}
+	}
+
+	ply := len(game.Moves) / 2
+	var lastMove string
+	if ply > gc.ply {
+		lastMove = game.Moves[len(game.Moves)-2:]
+	}
+	gc.ply = ply
+	gc.status = game.Status
+	gc.drawOffered = game.DrawOffer != "" && !strings.EqualFold(game.DrawOffer, gc.username)
+	if len(game.Clocks) == 2 {
+		gc.clocks = [2]time.Duration{
+			time.Duration(game.Clocks[0]) * 100 * time.Millisecond,
+			time.Duration(game.Clocks[1]) * 100 * time.Millisecond,
+		}
+		gc.clockUpdated = time.Now()
+	}
+	if game.BaseTime > 0 {
+		gc.baseTime = time.Duration(game.BaseTime) * 100 * time.Millisecond
+	}
+	if len(game.Results) == 2 && gc.myColor != "" {
+		if gc.myColor == "white" {
+			gc.resultCode = game.Results[0]
+		} else {
+			gc.resultCode = game.Results[1]
+		}
+	}
+	if game.TimeIncrement > 0 {
+		gc.increment = time.Duration(game.TimeIncrement) * 100 * time.Millisecond
+	}
+
+	// Replay the moves ourselves and cross-check the result against the server's position
+	fen := game.FEN
+	if board, err := boardFromTCN(game.Moves); err != nil {
+		logger.Warnf("[%s] Failed to replay the moves of game %s: %v\n", gc.username, gc.gameID, err)
+	} else if derived := board.FEN(); fen != "" && !samePosition(fen, derived) {
+		logger.Debugf("[%s] Server position for game %s (%s) differs from the replayed moves (%s), using the server's\n", gc.username, gc.gameID, fen, derived)
+	} else {
+		fen = derived
+	}
+	if fen != "" {
 		gc.currentFEN = fen
 	}
-	
-	if myTurn, ok := update["isMyTurn"].(bool); ok {
-		gc.isMyTurn = myTurn
+
+	whiteToMove := ply%2 == 0
+	gc.isMyTurn = gc.myColor != "" && whiteToMove == (gc.myColor == "white")
+	position := gc.positionLocked()
+	gc.mu.Unlock()
+
+	// A finished game also wakes anyone waiting for a move
+	if lastMove != "" || position.GameOver {
+		select {
+		case gc.moveChannel <- lastMove:
+		default:
+		}
 	}
-	
+
 	// Notify position update
 	select {
-	case gc.positionUpdate <- gc.GetCurrentPosition():
+	case gc.positionUpdate <- position:
 	default:
 	}
 }
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // GameInfo represents information about an active game
@@ -29,29 +31,29 @@ type GameSeekRequest struct {
 func FindActiveGames(client *http.Client, cookie string) ([]GameInfo, error) {
 	// Note: This is a placeholder implementation
 	// In reality, you would need to call chess.com's API to get active games
-	
+
 	req, err := http.NewRequest("GET", "https://www.chess.com/callback/live/games", nil)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	req.Header = getHeaders(cookie)
-	
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get active games: %s", resp.Status)
 	}
-	
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Note: This would need to be updated based on actual API response
 	var games []GameInfo
 	if err := json.Unmarshal(body, &games); err != nil {
@@ -59,81 +61,71 @@ func FindActiveGames(client *http.Client, cookie string) ([]GameInfo, error) {
 		logger.Printf("Note: Active game discovery not fully implemented yet\n")
 		return []GameInfo{}, nil
 	}
-	
+
 	return games, nil
 }
 
-// CreateGameSeek creates a game seek on chess.com
-func CreateGameSeek(client *http.Client, cookie string, seek GameSeekRequest) (*GameInfo, error) {
-	// Note: This is a placeholder implementation
-	// In reality, you would need to call chess.com's API to create a game seek
-	
-	payload, err := json.Marshal(seek)
-	if err != nil {
-		return nil, err
-	}
-	
-	req, err := http.NewRequest("POST", "https://www.chess.com/api/game/seek", strings.NewReader(string(payload)))
-	if err != nil {
-		return nil, err
-	}
-	
-	req.Header = getHeaders(cookie)
-	
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to create game seek: %s - %s", resp.Status, string(body))
-	}
-	
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// CreateGameSeek posts a live game seek through the CometD live subsystem and waits up to timeout
+// for an opponent, returning the game that was started
+func CreateGameSeek(account *Account, seek GameSeekRequest, timeout time.Duration) (*GameInfo, error) {
+	gameClient := NewGameClient(account)
+	defer gameClient.Close()
+
+	return gameClient.Seek(seek, timeout)
+}
+
+// parseTimeControl converts a time control like "5+0", "10+5" or "0.5+0" (minutes plus increment
+// seconds) into base and increment seconds
+func parseTimeControl(s string) (baseSec, incSec int, err error) {
+	base, inc, hasInc := strings.Cut(strings.TrimSpace(s), "+")
+	minutes, err := strconv.ParseFloat(base, 64)
+	if err != nil || minutes <= 0 {
+		return 0, 0, fmt.Errorf("invalid time control '%s': expected minutes+increment, e.g. 5+0", s)
+	}
+	if hasInc {
+		incSec, err = strconv.Atoi(inc)
+		if err != nil || incSec < 0 {
+			return 0, 0, fmt.Errorf("invalid increment in time control '%s'", s)
+		}
 	}
-	
-	var gameInfo GameInfo
-	if err := json.Unmarshal(body, &gameInfo); err != nil {
-		return nil, fmt.Errorf("failed to parse game info: %w", err)
+
+	baseSec = int(minutes * 60)
+	if float64(baseSec) != minutes*60 {
+		return 0, 0, fmt.Errorf("invalid time control '%s': base time must be a whole number of seconds", s)
 	}
-	
-	return &gameInfo, nil
+	return baseSec, incSec, nil
 }
 
 // GetGameState retrieves the current state of a game
 func GetGameState(client *http.Client, cookie string, gameID string) (*GamePosition, error) {
 	// Note: This is a placeholder implementation
-	
+
 	req, err := http.NewRequest("GET", fmt.Sprintf("https://www.chess.com/callback/game/%s", gameID), nil)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	req.Header = getHeaders(cookie)
-	
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-	
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("failed to get game state: %s", resp.Status)
 	}
-	
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-	
+
 	var position GamePosition
 	if err := json.Unmarshal(body, &position); err != nil {
 		return nil, fmt.Errorf("failed to parse game state: %w", err)
 	}
-	
+
 	return &position, nil
 }
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestParseTimeControl(t *testing.T) {
+	tests := []struct {
+		input   string
+		base    int
+		inc     int
+		wantErr bool
+	}{
+		{input: "5+0", base: 300, inc: 0},
+		{input: "3+2", base: 180, inc: 2},
+		{input: "10+5", base: 600, inc: 5},
+		{input: "0.5+0", base: 30, inc: 0},
+		{input: "1", base: 60, inc: 0},
+		{input: " 15+10 ", base: 900, inc: 10},
+		{input: "", wantErr: true},
+		{input: "+2", wantErr: true},
+		{input: "5+", wantErr: true},
+		{input: "five+0", wantErr: true},
+		{input: "5+two", wantErr: true},
+		{input: "5+2+1", wantErr: true},
+		{input: "5+1.5", wantErr: true},
+		{input: "0.01+0", wantErr: true},
+		{input: "0+1", wantErr: true},
+		{input: "-5+0", wantErr: true},
+		{input: "5+-2", wantErr: true},
+		{input: "NaN+0", wantErr: true},
+		{input: "Inf+0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			base, inc, err := parseTimeControl(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTimeControl(%q) = %d, %d, want an error", tt.input, base, inc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimeControl(%q) error: %v", tt.input, err)
+			}
+			if base != tt.base || inc != tt.inc {
+				t.Errorf("parseTimeControl(%q) = %d, %d, want %d, %d", tt.input, base, inc, tt.base, tt.inc)
+			}
+		})
+	}
+}
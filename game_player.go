@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"math/rand"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -12,8 +15,116 @@ type GameStrategy struct {
 	ThinkTimeMs int    `json:"think_time_ms"`
 	TimeMode    string `json:"time_mode"`
 	AutoMove    bool   `json:"auto_move"`
+	Depth       *int   `json:"depth,omitempty"` // Overrides the engine's search depth, 0 searches for think_time_ms
+	// Resign once the engine score for us drops below this many centipawns
+	ResignBelowCp *int `json:"resign_below_cp,omitempty"`
+	// Accept an opponent's draw offer when the engine score for us is below this many centipawns,
+	// declining it otherwise. Offers are always declined when unset
+	AcceptDrawBelowCp *int `json:"accept_draw_below_cp,omitempty"`
+	// Opening book to play from before searching with the engine, a Polyglot .bin file or a text
+	// book like opening_book.txt
+	BookPath string `json:"book_path,omitempty"`
+	// Ponder on the expected reply while waiting for the opponent's move
+	Ponder bool `json:"ponder,omitempty"`
+	// Vary each move's think time randomly by up to this many percent either way, so moves don't
+	// all take the same time
+	ThinkTimeJitterPct int `json:"think_time_jitter_pct,omitempty"`
 }
 
+const (
+	// clockMovesToGo is how many more moves the clock is assumed to have to last for
+	clockMovesToGo = 30
+	// minClockThinkTime is the least time a move is given, however low the clock
+	minClockThinkTime = 50 * time.Millisecond
+	// maxThinkTimeJitterPct caps think_time_jitter_pct so a move always gets some time
+	maxThinkTimeJitterPct = 90
+)
+
+// gameThinkTime budgets the search time for the next move from our remaining clock and the
+// increment, capped by the strategy's think time. Without clock data it is the strategy's think time
+func gameThinkTime(position GamePosition, strategy *GameStrategy) time.Duration {
+	maxThink := time.Duration(strategy.ThinkTimeMs) * time.Millisecond
+	if position.MyTime <= 0 {
+		return maxThink
+	}
+
+	budget := position.MyTime/clockMovesToGo + position.Increment*3/4
+	// Never spend more than a quarter of what's left, however big the increment
+	if limit := position.MyTime / 4; budget > limit {
+		budget = limit
+	}
+	if maxThink > 0 && budget > maxThink {
+		budget = maxThink
+	}
+	if budget < minClockThinkTime {
+		budget = minClockThinkTime
+	}
+	return budget
+}
+
+// jitterThinkTime randomly moves thinkTime up or down by up to pct percent
+func jitterThinkTime(thinkTime time.Duration, pct int) time.Duration {
+	pct = min(pct, maxThinkTimeJitterPct)
+	if pct <= 0 || thinkTime <= 0 {
+		return thinkTime
+	}
+	spread := int64(thinkTime) * int64(pct) / 100
+	return max(thinkTime+time.Duration(rand.Int63n(2*spread+1)-spread), minClockThinkTime)
+}
+
+// GameResult is how a played game ended, from the account's perspective
+type GameResult struct {
+	GameID      string
+	Opponent    string
+	TimeControl string // e.g. "3+2"
+	Outcome     string // "win", "loss", "draw" or "aborted", empty when unknown
+	Reason      string // chess.com's result code, e.g. "checkmated" or "timeout"
+	Moves       int
+}
+
+// gameOutcome maps a chess.com result code for the account to an outcome
+func gameOutcome(code string) string {
+	switch code {
+	case "":
+		return ""
+	case "win":
+		return "win"
+	case "agreed", "repetition", "stalemate", "insufficient", "50move", "timevsinsufficient":
+		return "draw"
+	case "aborted":
+		return "aborted"
+	default:
+		return "loss"
+	}
+}
+
+func describeGameResult(result GameResult) string {
+	switch {
+	case result.Outcome == "":
+		return "Result unknown."
+	case result.Reason == "" || result.Reason == result.Outcome:
+		return fmt.Sprintf("Game %s.", resultVerb(result.Outcome))
+	default:
+		return fmt.Sprintf("Game %s (%s).", resultVerb(result.Outcome), result.Reason)
+	}
+}
+
+func resultVerb(outcome string) string {
+	switch outcome {
+	case "win":
+		return "won"
+	case "loss":
+		return "lost"
+	case "draw":
+		return "drawn"
+	default:
+		return outcome
+	}
+}
+
+// maxIllegalMoves is how many illegal engine moves in a row PlayGame tolerates before giving up
+const maxIllegalMoves = 3
+
 // GamePlayer manages playing a single game
 type GamePlayer struct {
 	client   *http.Client
@@ -35,47 +146,148 @@ func NewGamePlayer(client *http.Client, account *Account, strategy *GameStrategy
 }
 
 // PlayGame plays a single game
-func (gp *GamePlayer) PlayGame() error {
-	logger.Printf("[%s] Starting game %s with strategy '%s'\n", gp.account.Username, gp.gameID, gp.strategy.Name)
-	
+func (gp *GamePlayer) PlayGame() (GameResult, error) {
+	logger.Infof("[%s] Starting game %s with strategy '%s'\n", gp.account.Username, gp.gameID, gp.strategy.Name)
+
 	// Create game client
-	gameClient := NewGameClient(gp.account.Cookie)
+	gameClient := NewGameClient(gp.account)
 	defer gameClient.Close()
-	
+
 	// Connect to game
 	if err := gameClient.ConnectToGame(gp.gameID); err != nil {
-		// If WebSocket connection fails, return error with guidance
-		logger.Printf("[%s] WebSocket connection note: %v\n", gp.account.Username, err)
-		return fmt.Errorf("live game playing not yet fully implemented - requires chess.com CometD protocol reverse engineering. Please use the userscript approach (./chesshook2 userscript generate) for browser-based game playing: %w", err)
+		return gameClient.Result(), fmt.Errorf("error connecting to game: %w", err)
 	}
-	
+
+	var book *OpeningBook
+	if gp.strategy.BookPath != "" {
+		var err error
+		if book, err = LoadOpeningBook(gp.strategy.BookPath); err != nil {
+			logger.Warnf("[%s] Failed to load opening book, playing without it: %v\n", gp.account.Username, err)
+		}
+	}
+
+	// The search pondering the opponent's expected reply, if any
+	var ponder *PonderSearch
+	defer func() {
+		if ponder != nil {
+			gp.engine.StopPonder(ponder)
+		}
+	}()
+
 	// Main game loop
+	illegalMoves := 0
 	for {
 		position := gameClient.GetCurrentPosition()
-		
-		if !position.IsMyTurn {
+
+		if position.GameOver {
+			result := gameClient.Result()
+			logger.Infof("[%s] Game %s is over: %s\n", gp.account.Username, gp.gameID, describeGameResult(result))
+			return result, nil
+		}
+
+		if !position.IsMyTurn || position.FEN == "" {
 			// Wait for opponent's move
 			_, err := gameClient.WaitForMove(5 * time.Minute)
 			if err != nil {
-				return fmt.Errorf("error waiting for move: %w", err)
+				return gameClient.Result(), fmt.Errorf("error waiting for move: %w", err)
 			}
 			continue
 		}
-		
+
+		var analysis *EngineAnalysis
+		if ponder != nil {
+			analysis = gp.finishPonder(ponder, position.FEN)
+			ponder = nil
+		}
+
+		// Book moves skip the engine, unless a draw offer needs an evaluation
+		if bookMove, ok := book.PickMove(position.FEN); ok && !position.DrawOffered {
+			logger.Debugf("[%s] Book move: %s\n", gp.account.Username, bookMove)
+			if err := gp.sendMove(gameClient, bookMove, position.FEN); err != nil {
+				return gameClient.Result(), err
+			}
+			continue
+		}
+
 		// Analyze position and get best move
-		thinkTime := time.Duration(gp.strategy.ThinkTimeMs) * time.Millisecond
-		analysis, err := gp.engine.AnalyzePosition(position.FEN, thinkTime)
+		thinkTime := jitterThinkTime(gameThinkTime(position, gp.strategy), gp.strategy.ThinkTimeJitterPct)
+		depth := gp.engine.Depth
+		if gp.strategy.Depth != nil {
+			depth = *gp.strategy.Depth
+		}
+		var err error
+		if analysis == nil {
+			// With a clock, the depth limit must not make us flag. Without one, a depth limit alone ends the search
+			limit := SearchLimit{Depth: depth, MoveTime: thinkTime}
+			if position.MyTime <= 0 && depth > 0 {
+				limit.MoveTime = 0
+			}
+			analysis, err = gp.engine.AnalyzeWithProgress(position.FEN, limit, gp.searchProgress(position.FEN))
+			logger.RemoveLine(gp.gameID)
+		}
 		if err != nil {
-			return fmt.Errorf("error analyzing position: %w", err)
+			return gameClient.Result(), fmt.Errorf("error analyzing position: %w", err)
 		}
-		
-		logger.Printf("[%s] Best move: %s (score: %d)\n", gp.account.Username, analysis.BestMove, analysis.Score)
-		
-		// Send move
-		if err := gameClient.SendMove(analysis.BestMove); err != nil {
-			return fmt.Errorf("error sending move: %w", err)
+
+		if analysis.TBHits > 0 {
+			logger.Debugf("[%s] Best move: %s (score: %d, tablebase hits: %d)\n", gp.account.Username, analysis.BestMove, analysis.Score, analysis.TBHits)
+		} else {
+			logger.Debugf("[%s] Best move: %s (score: %d)\n", gp.account.Username, analysis.BestMove, analysis.Score)
 		}
-		
+
+		score := analysis.ScoreCp()
+		if position.DrawOffered {
+			if gp.strategy.AcceptDrawBelowCp != nil && score < *gp.strategy.AcceptDrawBelowCp {
+				if err := gameClient.AcceptDraw(); err != nil {
+					return gameClient.Result(), fmt.Errorf("error accepting draw: %w", err)
+				}
+				logger.Infof("[%s] Accepted draw offer in game %s at %s\n", gp.account.Username, gp.gameID, formatScore(analysis))
+				result := gameClient.Result()
+				result.Outcome, result.Reason = "draw", "agreed"
+				return result, nil
+			}
+			logger.Infof("[%s] Declining draw offer in game %s at %s\n", gp.account.Username, gp.gameID, formatScore(analysis))
+			if err := gameClient.DeclineDraw(); err != nil {
+				return gameClient.Result(), fmt.Errorf("error declining draw: %w", err)
+			}
+		}
+		if gp.strategy.ResignBelowCp != nil && score < *gp.strategy.ResignBelowCp {
+			if err := gameClient.Resign(); err != nil {
+				return gameClient.Result(), fmt.Errorf("error resigning: %w", err)
+			}
+			logger.Infof("[%s] Resigned game %s at %s\n", gp.account.Username, gp.gameID, formatScore(analysis))
+			result := gameClient.Result()
+			result.Outcome, result.Reason = "loss", "resigned"
+			return result, nil
+		}
+
+		board, err := ParseFEN(position.FEN)
+		if err != nil {
+			return gameClient.Result(), fmt.Errorf("error parsing position: %w", err)
+		}
+		if !board.IsLegal(analysis.BestMove) {
+			illegalMoves++
+			if illegalMoves >= maxIllegalMoves {
+				return gameClient.Result(), fmt.Errorf("engine move %s is illegal in %s, giving up after %d attempts", analysis.BestMove, position.FEN, illegalMoves)
+			}
+			logger.Warnf("[%s] Engine move %s is illegal in %s, requesting a fresh game state\n", gp.account.Username, analysis.BestMove, position.FEN)
+			state, err := GetGameState(gp.client, gp.account.Cookie, gp.gameID)
+			if err != nil {
+				return gameClient.Result(), fmt.Errorf("error refreshing game state: %w", err)
+			}
+			gameClient.SetPosition(state.FEN)
+			continue
+		}
+		illegalMoves = 0
+
+		if err := gp.sendMove(gameClient, analysis.BestMove, position.FEN); err != nil {
+			return gameClient.Result(), err
+		}
+
+		if gp.strategy.Ponder {
+			ponder = gp.startPonder(position.FEN, analysis, depth, thinkTime)
+		}
+
 		// Add delay for legit mode
 		if gp.strategy.TimeMode == "legit" {
 			delay := time.Duration(500+time.Now().UnixNano()%1500) * time.Millisecond
@@ -84,29 +296,233 @@ func (gp *GamePlayer) PlayGame() error {
 	}
 }
 
-// PlayAllGamesForAccount plays all active games for an account
-func PlayAllGamesForAccount(client *http.Client, account *Account, strategy *GameStrategy, engine *ChessEngine) error {
-	logger.Printf("[%s] Looking for active games...\n", account.Username)
-	
+// startPonder starts pondering the reply the engine expects to the move it just found for fen,
+// returning nil when it has no expected reply or the engine is needed elsewhere
+func (gp *GamePlayer) startPonder(fen string, analysis *EngineAnalysis, depth int, thinkTime time.Duration) *PonderSearch {
+	reply := analysis.PonderMove
+	if reply == "" && len(analysis.PV) >= 2 && analysis.PV[0] == analysis.BestMove {
+		reply = analysis.PV[1]
+	}
+	if reply == "" {
+		return nil
+	}
+
+	board, err := ParseFEN(fen)
+	if err != nil {
+		return nil
+	}
+	if board.ApplyUCI(analysis.BestMove) != nil || board.ApplyUCI(reply) != nil {
+		return nil
+	}
+
+	ponder, err := gp.engine.StartPonder(board.FEN(), depth, thinkTime)
+	if err != nil {
+		logger.Warnf("[%s] Failed to start pondering: %v\n", gp.account.Username, err)
+		return nil
+	}
+	return ponder
+}
+
+// searchProgress returns a callback showing the move the engine is searching in the game's live line
+func (gp *GamePlayer) searchProgress(fen string) func(SearchProgress) {
+	moves := 0
+	if board, err := ParseFEN(fen); err == nil {
+		moves = len(board.LegalMoves())
+	}
+	return func(progress SearchProgress) {
+		number := fmt.Sprintf("%d", progress.CurrMoveNumber)
+		if moves > 0 {
+			number = fmt.Sprintf("%d/%d", progress.CurrMoveNumber, moves)
+		}
+		logger.AddLine(gp.gameID, fmt.Sprintf("[%s] Analyzing move %s: %s at depth %d", gp.account.Username, number, progress.CurrMove, progress.Depth))
+	}
+}
+
+// finishPonder ends a ponder search now that the opponent has moved, returning its analysis when
+// they played the expected reply and nil when the position has to be searched from scratch
+func (gp *GamePlayer) finishPonder(ponder *PonderSearch, fen string) *EngineAnalysis {
+	if !samePosition(ponder.FEN, fen) {
+		gp.engine.StopPonder(ponder)
+		return nil
+	}
+
+	analysis, err := gp.engine.PonderHit(ponder)
+	if err != nil {
+		logger.Debugf("[%s] Ponder search not usable, searching again: %v\n", gp.account.Username, err)
+		return nil
+	}
+	logger.Debugf("[%s] Ponder hit in game %s\n", gp.account.Username, gp.gameID)
+	return analysis
+}
+
+// sendMove encodes a UCI move for chess.com and sends it
+func (gp *GamePlayer) sendMove(gameClient *GameClient, uci string, fen string) error {
+	move, err := uciToChessComMove(uci, fen)
+	if err != nil {
+		return fmt.Errorf("error encoding move %s: %w", uci, err)
+	}
+	if err := gameClient.SendMove(move); err != nil {
+		return fmt.Errorf("error sending move: %w", err)
+	}
+	return nil
+}
+
+// formatScore describes an engine score from our perspective
+func formatScore(analysis *EngineAnalysis) string {
+	if analysis.Mate != 0 {
+		return fmt.Sprintf("mate in %d", analysis.Mate)
+	}
+	return fmt.Sprintf("%+d cp", analysis.Score)
+}
+
+// PlayAllGamesForAccount plays all active games for an account, up to maxGames at a time
+func PlayAllGamesForAccount(client *http.Client, account *Account, strategy *GameStrategy, engine *ChessEngine, notifier Notifier, maxGames int) error {
+	logger.Infof("[%s] Looking for active games...\n", account.Username)
+
+	client, err := accountHTTPClient(client, account)
+	if err != nil {
+		return err
+	}
+
 	games, err := FindActiveGames(client, account.Cookie)
 	if err != nil {
 		return fmt.Errorf("error finding active games: %w", err)
 	}
-	
+
 	if len(games) == 0 {
-		logger.Printf("[%s] No active games found\n", account.Username)
+		logger.Infof("[%s] No active games found\n", account.Username)
 		return nil
 	}
-	
-	logger.Printf("[%s] Found %d active games\n", account.Username, len(games))
-	
-	for _, game := range games {
-		player := NewGamePlayer(client, account, strategy, engine, game.GameID)
-		if err := player.PlayGame(); err != nil {
-			logger.Printf("[%s] Error playing game %s: %v\n", account.Username, game.GameID, err)
-			continue
-		}
+
+	logger.Infof("[%s] Found %d active games\n", account.Username, len(games))
+
+	if maxGames < 1 {
+		maxGames = 1
 	}
-	
+
+	// Games mostly wait on the opponent, so several run at once and share the engine
+	results := make([]GameResult, len(games))
+	gameErrors := make([]error, len(games))
+	semaphore := make(chan struct{}, maxGames)
+	var wg sync.WaitGroup
+	for i, game := range games {
+		wg.Add(1)
+		go func(i int, game GameInfo) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			player := NewGamePlayer(client, account, strategy, engine, game.GameID)
+			result, err := player.PlayGame()
+			result.GameID = game.GameID
+			if result.Opponent == "" {
+				result.Opponent = game.WhitePlayer
+				if strings.EqualFold(game.WhitePlayer, account.Username) {
+					result.Opponent = game.BlackPlayer
+				}
+			}
+			if result.TimeControl == "" {
+				result.TimeControl = game.TimeControl
+			}
+			if err != nil {
+				logger.Errorf("[%s] Error playing game %s: %v\n", account.Username, game.GameID, err)
+			}
+			notifier.Send(WebhookPayload{Embeds: []Embed{buildGameResultEmbed(account, strategy, result, err)}})
+			results[i] = result
+			gameErrors[i] = err
+		}(i, game)
+	}
+	wg.Wait()
+
+	notifier.Send(WebhookPayload{Embeds: fitEmbeds(buildGameSummaryEmbed(account, results, gameErrors))})
 	return nil
 }
+
+// buildGameResultEmbed reports a single finished game
+func buildGameResultEmbed(account *Account, strategy *GameStrategy, result GameResult, err error) Embed {
+	var color int
+	description := describeGameResult(result)
+	switch {
+	case err != nil:
+		description = fmt.Sprintf("Stopped playing: %v", err)
+		color = 15158332 // Red
+	case result.Outcome == "win":
+		color = 3066993 // Green
+	case result.Outcome == "loss":
+		color = 15158332 // Red
+	case result.Outcome == "draw":
+		color = 16776960 // Yellow
+	default:
+		color = 3447003
+	}
+
+	opponent := result.Opponent
+	if opponent == "" {
+		opponent = "Unknown"
+	}
+	timeControl := result.TimeControl
+	if timeControl == "" {
+		timeControl = "Unknown"
+	}
+
+	return Embed{
+		Title:       fmt.Sprintf("Game report for %s", account.Username),
+		Description: description,
+		Color:       color,
+		Fields: []EmbedField{
+			{Name: "Opponent", Value: opponent, Inline: true},
+			{Name: "Time Control", Value: timeControl, Inline: true},
+			{Name: "Moves", Value: fmt.Sprintf("%d", result.Moves), Inline: true},
+			{Name: "Strategy", Value: strategy.Name, Inline: true},
+			{Name: "Game", Value: fmt.Sprintf("https://www.chess.com/game/live/%s", result.GameID), Inline: false},
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+}
+
+// buildGameSummaryEmbed summarizes all games played for an account in this run
+func buildGameSummaryEmbed(account *Account, results []GameResult, gameErrors []error) Embed {
+	var wins, losses, draws, other, errored []string
+	for i, result := range results {
+		line := result.GameID
+		if result.Opponent != "" {
+			line = fmt.Sprintf("%s vs %s", result.GameID, result.Opponent)
+		}
+		switch {
+		case gameErrors[i] != nil:
+			errored = append(errored, line)
+		case result.Outcome == "win":
+			wins = append(wins, line)
+		case result.Outcome == "loss":
+			losses = append(losses, line)
+		case result.Outcome == "draw":
+			draws = append(draws, line)
+		default:
+			other = append(other, line)
+		}
+	}
+
+	embed := Embed{
+		Title:       fmt.Sprintf("Game summary for %s", account.Username),
+		Description: fmt.Sprintf("%d game(s) played: %d won, %d lost, %d drawn.", len(results), len(wins), len(losses), len(draws)),
+		Color:       3447003,
+		Timestamp:   time.Now().Format(time.RFC3339),
+		Fields:      []EmbedField{},
+	}
+	if len(wins) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "✅ Won", Value: strings.Join(wins, "\n"), Inline: false})
+	}
+	if len(losses) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "❌ Lost", Value: strings.Join(losses, "\n"), Inline: false})
+	}
+	if len(draws) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "🤝 Drawn", Value: strings.Join(draws, "\n"), Inline: false})
+	}
+	if len(other) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "⏹️ Aborted or unknown", Value: strings.Join(other, "\n"), Inline: false})
+	}
+	if len(errored) > 0 {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "⚠️ Errors", Value: strings.Join(errored, "\n"), Inline: false})
+	}
+	return embed
+}
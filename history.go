@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// HistoryEntry is a solved puzzle tagged with the account that solved it
+type HistoryEntry struct {
+	AccountID string `json:"account_id"`
+	Username  string `json:"username"`
+	SolvedPuzzle
+}
+
+var historyMu sync.Mutex
+
+// appendHistory appends an entry as a single JSON line so concurrent accounts never interleave
+func appendHistory(path string, entry HistoryEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(line)
+	return err
+}
+
+// loadHistory reads all entries, only keeping those of account when it is not nil
+func loadHistory(path string, account *Account) ([]HistoryEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []HistoryEntry{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]HistoryEntry, 0)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse history line %d: %w", lineNumber, err)
+		}
+		if account != nil && !historyEntryBelongsTo(entry, account) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func historyEntryBelongsTo(entry HistoryEntry, account *Account) bool {
+	if entry.AccountID != "" && account.ID != "" {
+		return entry.AccountID == account.ID
+	}
+	return entry.Username == account.Username
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// defaultHTTPTimeout bounds a whole request, including reading the body, when config.json doesn't
+// set http_timeout_seconds
+const defaultHTTPTimeout = 30 * time.Second
+
+// puzzleRequestBudget is how many request timeouts a single puzzle (stats, fetch, verify and
+// submit) may take in total before it is abandoned
+const puzzleRequestBudget = 4
+
+// sharedTransport is used by every client so connections to chess.com are pooled across accounts
+var sharedTransport = newHTTPTransport(http.ProxyFromEnvironment)
+
+var (
+	proxyTransports   = make(map[string]*http.Transport)
+	proxyTransportsMu sync.Mutex
+)
+
+func newHTTPTransport(proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 20 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   16,
+	}
+}
+
+// requestTimeout is the deadline for a single chess.com request, cfg may be nil for commands that
+// don't load config.json
+func requestTimeout(cfg *AppConfig) time.Duration {
+	if cfg != nil && cfg.HTTPTimeoutSeconds > 0 {
+		return time.Duration(cfg.HTTPTimeoutSeconds) * time.Second
+	}
+	return defaultHTTPTimeout
+}
+
+// requestContext derives the context for a single chess.com request from ctx
+func requestContext(ctx context.Context, cfg *AppConfig) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, requestTimeout(cfg))
+}
+
+// newHTTPClient returns a client on the shared transport with the configured overall timeout
+func newHTTPClient(cfg *AppConfig) *http.Client {
+	return &http.Client{Transport: sharedTransport, Timeout: requestTimeout(cfg)}
+}
+
+// accountHTTPClient returns the client to use for an account's requests: client itself, or a copy
+// routed through the account's proxy when it has one. Transports are shared between accounts
+// using the same proxy
+func accountHTTPClient(client *http.Client, account *Account) (*http.Client, error) {
+	if account.Proxy == "" {
+		return client, nil
+	}
+
+	proxy, err := accountProxy(account)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyTransportsMu.Lock()
+	transport, ok := proxyTransports[account.Proxy]
+	if !ok {
+		transport = newHTTPTransport(proxy)
+		proxyTransports[account.Proxy] = transport
+	}
+	proxyTransportsMu.Unlock()
+
+	proxied := *client
+	proxied.Transport = transport
+	return &proxied, nil
+}
+
+// accountProxy returns how an account's connections pick their proxy: the account's own proxy, or
+// the environment's when it has none
+func accountProxy(account *Account) (func(*http.Request) (*url.URL, error), error) {
+	if account.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(account.Proxy)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy '%s' for account %s", account.Proxy, account.Username)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
@@ -1,15 +1,95 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 )
 
+// LogLevel is how important a message is, messages below the logger's level are dropped
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota // Per-request and per-move detail
+	LevelInfo                  // Progress of a run, the default
+	LevelWarn                  // Something was skipped or worked around
+	LevelError                 // Something failed
+)
+
+// Colors that call sites can tag lines with through Colorize
+const (
+	ColorGreen  = "\033[32m" // Success
+	ColorYellow = "\033[33m" // Cooldowns and warnings
+	ColorRed    = "\033[31m" // Errors
+	ColorDim    = "\033[2m"  // Debug detail
+	colorReset  = "\033[0m"
+)
+
+// levelColors are the colors the leveled methods print in, info keeps the terminal's default
+var levelColors = map[LogLevel]string{
+	LevelDebug: ColorDim,
+	LevelWarn:  ColorYellow,
+	LevelError: ColorRed,
+}
+
+var logLevelNames = map[string]LogLevel{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+}
+
+// parseLogLevel reads a level name as given to --verbosity or CHESSHOOK_LOG_LEVEL
+func parseLogLevel(name string) (LogLevel, error) {
+	level, ok := logLevelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LevelInfo, fmt.Errorf("unknown log level '%s', use debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
 type Logger struct {
+	level           LogLevel
 	persistentLines map[string]string
 	orderedKeys     []string
 	lastUpdateLines int
+	ansi            bool // Whether cursor movement can be used to redraw the persistent lines
+	sink            io.Writer
+	sinkAtLineStart bool
 	mu              sync.Mutex
+	countdowns      map[string]*countdown
+	countdownsMu    sync.Mutex
+	dashboard       *Dashboard // When set, output is shown on the dashboard instead of printed
+}
+
+type countdown struct {
+	cancel context.CancelFunc
+}
+
+var ansiEscapePattern = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// stdoutIsTerminal reports whether stdout is a character device rather than a pipe or file
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func ansiSupported() bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return stdoutIsTerminal()
 }
 
 func ansiMoveUp() {
@@ -29,28 +109,246 @@ func ansiClearLine() {
 
 func NewLogger() *Logger {
 	return &Logger{
+		level:           LevelInfo,
 		persistentLines: make(map[string]string),
 		orderedKeys:     make([]string, 0),
 		lastUpdateLines: 0,
+		ansi:            ansiSupported(),
+		countdowns:      make(map[string]*countdown),
+	}
+}
+
+// SetSink mirrors every Printf/Println to w, without ANSI codes or persistent lines
+func (l *Logger) SetSink(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sink = w
+	l.sinkAtLineStart = true
+}
+
+// OpenLogFile appends all logged output to the file at path
+func (l *Logger) OpenLogFile(path string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	l.SetSink(file)
+	return nil
+}
+
+// writeSink writes text to the sink, prefixing every new line with a timestamp
+func (l *Logger) writeSink(text string) {
+	if l.sink == nil || text == "" {
+		return
+	}
+
+	text = ansiEscapePattern.ReplaceAllString(text, "")
+
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		if l.sinkAtLineStart {
+			b.WriteString(time.Now().Format(time.RFC3339))
+			b.WriteString(" ")
+		}
+		b.WriteString(line)
+		l.sinkAtLineStart = strings.HasSuffix(line, "\n")
+	}
+	io.WriteString(l.sink, b.String())
+}
+
+// SetANSI enables or disables redrawing the persistent lines with ANSI escape codes
+func (l *Logger) SetANSI(enabled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ansi = enabled
+	if !enabled {
+		l.lastUpdateLines = 0
+	}
+}
+
+// SetLevel drops Debugf/Infof/Warnf/Errorf messages below level. Above info the persistent
+// progress lines are hidden too, Printf and Println are always shown
+func (l *Logger) SetLevel(level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.level = level
+}
+
+// Enabled reports whether messages at level are shown
+func (l *Logger) Enabled(level LogLevel) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return level >= l.level
+}
+
+// Colorize wraps text in color when the terminal supports it. A trailing newline is kept outside
+// the color so the next line starts uncolored
+func (l *Logger) Colorize(color, text string) string {
+	l.mu.Lock()
+	ansi := l.ansi
+	l.mu.Unlock()
+
+	if !ansi || color == "" {
+		return text
+	}
+	body := strings.TrimSuffix(text, "\n")
+	return color + body + colorReset + text[len(body):]
+}
+
+// logf prints a message at level in that level's color, if the logger's level lets it through
+func (l *Logger) logf(level LogLevel, color string, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
 	}
+	l.Printf("%s", l.Colorize(color, fmt.Sprintf(format, args...)))
+}
+
+// Debugf logs detail that is only useful when looking into a problem
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, levelColors[LevelDebug], format, args...)
+}
+
+// Infof logs the normal progress of a command
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, levelColors[LevelInfo], format, args...)
+}
+
+// Successf logs at info level in green, for something that completed
+func (l *Logger) Successf(format string, args ...interface{}) {
+	l.logf(LevelInfo, ColorGreen, format, args...)
+}
+
+// Warnf logs something that was skipped or worked around
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, levelColors[LevelWarn], format, args...)
+}
+
+// Errorf logs a failure
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LevelError, levelColors[LevelError], format, args...)
+}
+
+// SetDashboard hands output to d until it is called again with nil
+func (l *Logger) SetDashboard(d *Dashboard) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if d != nil && l.lastUpdateLines > 0 {
+		ansiCleanUp(l.lastUpdateLines)
+		l.lastUpdateLines = 0
+	}
+	l.dashboard = d
+	if d == nil {
+		l.updateDisplay()
+	}
+}
+
+// Dashboard returns the dashboard output is handed to, nil when there is none. Dashboard methods
+// do nothing on nil
+func (l *Logger) Dashboard() *Dashboard {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dashboard
 }
 
 func (l *Logger) AddLine(key, value string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	if _, exists := l.persistentLines[key]; !exists {
+	if l.level > LevelInfo {
+		return
+	}
+
+	previous, exists := l.persistentLines[key]
+	if !exists {
 		l.orderedKeys = append(l.orderedKeys, key)
 	}
 	l.persistentLines[key] = value
 
+	if l.dashboard != nil {
+		l.dashboard.Event(key, value)
+		return
+	}
+
+	if !l.ansi {
+		// Without cursor movement the lines can't be redrawn, so just print what changed
+		if !exists || previous != value {
+			fmt.Println(value)
+		}
+		return
+	}
+
 	l.updateDisplay()
 }
 
+// redraws reports whether persistent lines are redrawn in place, rather than printed as new lines
+func (l *Logger) redraws() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.ansi
+}
+
 func (l *Logger) GetLine(key string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	return l.persistentLines[key]
 }
 
+// StartCountdown updates the persistent line for key every second until delay has elapsed,
+// ctx is cancelled or the returned stop function is called. Starting a new countdown for the
+// same key stops the previous one, so at most one is alive per key.
+func (l *Logger) StartCountdown(ctx context.Context, key string, delay time.Duration, format func(timeLeft time.Duration) string) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	exited := make(chan struct{})
+	current := &countdown{cancel: cancel}
+
+	l.countdownsMu.Lock()
+	if previous, ok := l.countdowns[key]; ok {
+		previous.cancel()
+	}
+	l.countdowns[key] = current
+	l.countdownsMu.Unlock()
+
+	deadline := time.Now().Add(delay)
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for timeLeft := time.Until(deadline); timeLeft > 0; timeLeft = time.Until(deadline) {
+			l.AddLine(key, format(timeLeft.Round(time.Second)))
+			if !l.redraws() {
+				// Plain output would get a line for every second, so the countdown is only shown once
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		// Wait for the goroutine so it can't re-add the line after RemoveLine
+		<-exited
+		l.countdownsMu.Lock()
+		if l.countdowns[key] == current {
+			delete(l.countdowns, key)
+		}
+		l.countdownsMu.Unlock()
+	}
+}
+
 func (l *Logger) RemoveLine(key string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -70,11 +368,19 @@ func (l *Logger) Printf(format string, args ...interface{}) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	text := fmt.Sprintf(format, args...)
+	if l.dashboard != nil {
+		l.dashboard.Log(text)
+		l.writeSink(text)
+		return
+	}
+
 	if l.lastUpdateLines > 0 {
 		ansiCleanUp(l.lastUpdateLines)
 	}
 
-	fmt.Printf(format, args...)
+	fmt.Print(text)
+	l.writeSink(text)
 	l.lastUpdateLines = 0
 
 	l.updateDisplay()
@@ -84,17 +390,29 @@ func (l *Logger) Println(lines ...any) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	text := fmt.Sprintln(lines...)
+	if l.dashboard != nil {
+		l.dashboard.Log(text)
+		l.writeSink(text)
+		return
+	}
+
 	if l.lastUpdateLines > 0 {
 		ansiCleanUp(l.lastUpdateLines)
 	}
 
-	fmt.Println(lines...)
+	fmt.Print(text)
+	l.writeSink(text)
 	l.lastUpdateLines = 0
 
 	l.updateDisplay()
 }
 
 func (l *Logger) updateDisplay() {
+	if !l.ansi || l.dashboard != nil {
+		return
+	}
+
 	if l.lastUpdateLines > 0 {
 		ansiCleanUp(l.lastUpdateLines)
 	}
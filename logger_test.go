@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureStdout returns what f printed to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestCountdownWithoutANSIPrintsOnce(t *testing.T) {
+	l := NewLogger()
+	l.SetANSI(false)
+
+	output := captureStdout(t, func() {
+		stop := l.StartCountdown(context.Background(), "account", 2500*time.Millisecond, func(timeLeft time.Duration) string {
+			return "Waiting for " + timeLeft.String()
+		})
+		time.Sleep(2600 * time.Millisecond)
+		stop()
+	})
+
+	if lines := strings.Count(output, "Waiting for"); lines != 1 {
+		t.Fatalf("countdown printed %d lines, want 1:\n%s", lines, output)
+	}
+}
+
+func TestAddLineWithoutANSIPrintsChanges(t *testing.T) {
+	l := NewLogger()
+	l.SetANSI(false)
+
+	output := captureStdout(t, func() {
+		l.AddLine("account", "Solving puzzle 1/2")
+		l.AddLine("account", "Solving puzzle 1/2")
+		l.AddLine("account", "Solving puzzle 2/2")
+	})
+
+	if want := "Solving puzzle 1/2\nSolving puzzle 2/2\n"; output != want {
+		t.Fatalf("output = %q, want %q", output, want)
+	}
+}
+
+func TestDashboardIsClearedWhenStopped(t *testing.T) {
+	captureStdout(t, func() {
+		d := StartDashboard([]string{"account"})
+		if logger.Dashboard() != d {
+			t.Error("the logger doesn't hold the started dashboard")
+		}
+		d.Stop()
+	})
+	if d := logger.Dashboard(); d != nil {
+		t.Fatal("the logger still holds the dashboard after Stop")
+	}
+	// Without a dashboard the account updates do nothing
+	logger.Dashboard().AccountFinished("account", nil)
+}
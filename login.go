@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrLoginBadCredentials = errors.New("invalid username or password")
+	ErrLoginCaptcha        = errors.New("chess.com requested a captcha challenge, log in through the browser and use `accounts add` instead")
+	ErrLoginTwoFactor      = errors.New("two-factor authentication is required for this account, log in through the browser and use `accounts add` instead")
+)
+
+// loginToChessCom performs the form login flow through client, on a copy with a cookie jar of its
+// own, and returns the resulting session cookie header
+func loginToChessCom(client *http.Client, username, password string) (string, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return "", err
+	}
+
+	loginClient := *client
+	client = &loginClient
+	client.Jar = jar
+	// Stop at the first redirect so we can tell where chess.com wants to send us
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	// Fetch the login page for the CSRF token and initial cookies
+	req, err := http.NewRequest("GET", "https://www.chess.com/login", nil)
+	if err != nil {
+		return "", err
+	}
+	setLoginHeaders(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	reToken := regexp.MustCompile(`name="_token"\s+value="([^"]+)"`)
+	matches := reToken.FindStringSubmatch(string(body))
+	if len(matches) < 2 {
+		if isCaptchaPage(string(body)) {
+			return "", ErrLoginCaptcha
+		}
+		return "", errors.New("could not find login token on chess.com login page")
+	}
+
+	form := url.Values{}
+	form.Set("_username", username)
+	form.Set("_password", password)
+	form.Set("_token", matches[1])
+	form.Set("_remember_me", "1")
+	form.Set("login", "")
+
+	req, err = http.NewRequest("POST", "https://www.chess.com/login_check", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	setLoginHeaders(req)
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set("origin", "https://www.chess.com")
+
+	resp, err = client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	location := resp.Header.Get("Location")
+	switch {
+	case isCaptchaPage(string(body)) || strings.Contains(location, "captcha"):
+		return "", ErrLoginCaptcha
+	case strings.Contains(location, "two-factor") || strings.Contains(location, "2fa") || strings.Contains(location, "verify"):
+		return "", ErrLoginTwoFactor
+	case resp.StatusCode >= 300 && resp.StatusCode < 400 && strings.Contains(location, "/login"):
+		return "", ErrLoginBadCredentials
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		// Successful logins redirect away from the login page
+	case resp.StatusCode == http.StatusOK && strings.Contains(string(body), "Invalid username or password"):
+		return "", ErrLoginBadCredentials
+	default:
+		return "", fmt.Errorf("unexpected login response: %s", resp.Status)
+	}
+
+	chessURL, _ := url.Parse("https://www.chess.com/")
+	var cookieParts []string
+	hasSession := false
+	for _, c := range jar.Cookies(chessURL) {
+		if c.Name == "PHPSESSID" || c.Name == "CHESSCOM_REMEMBERME" {
+			hasSession = true
+		}
+		cookieParts = append(cookieParts, c.Name+"="+c.Value)
+	}
+	if !hasSession {
+		return "", errors.New("login did not return a session cookie")
+	}
+
+	return strings.Join(cookieParts, "; "), nil
+}
+
+func setLoginHeaders(req *http.Request) {
+	req.Header.Set("accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("accept-language", "en-US,en;q=0.9")
+	req.Header.Set("user-agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/138.0.0.0 Safari/537.36")
+	req.Header.Set("Referer", "https://www.chess.com/login")
+}
+
+func isCaptchaPage(body string) bool {
+	lower := strings.ToLower(body)
+	return strings.Contains(lower, "g-recaptcha") || strings.Contains(lower, "cf-turnstile") || strings.Contains(lower, "captcha-container")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseCookieFromCurl(t *testing.T) {
+	tests := []struct {
+		name    string
+		curl    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "bash cookie header",
+			curl: `curl 'https://www.chess.com/callback/tactics/stats' \
+  -H 'accept: application/json' \
+  -H 'cookie: PHPSESSID=abc123; CHESSCOM_REMEMBERME=xyz%3D' \
+  -H 'user-agent: Mozilla/5.0'`,
+			want: "PHPSESSID=abc123; CHESSCOM_REMEMBERME=xyz%3D",
+		},
+		{
+			name: "bash -b flag",
+			curl: `curl 'https://www.chess.com/puzzles/rated' \
+  -b 'PHPSESSID=abc123; ACCESS_TOKEN=tok' \
+  -H 'accept: */*'`,
+			want: "PHPSESSID=abc123; ACCESS_TOKEN=tok",
+		},
+		{
+			name: "bash double quoted",
+			curl: `curl "https://www.chess.com/puzzles/rated" -H "Cookie: PHPSESSID=abc123"`,
+			want: "PHPSESSID=abc123",
+		},
+		{
+			name: "cmd with caret escapes",
+			curl: "curl ^\"https://www.chess.com/puzzles/rated^\" ^\r\n" +
+				"  -H ^\"accept: application/json^\" ^\r\n" +
+				"  -H ^\"cookie: PHPSESSID=abc123; theme=dark^\"",
+			want: "PHPSESSID=abc123; theme=dark",
+		},
+		{
+			name: "PowerShell web session",
+			curl: "$session = New-Object Microsoft.PowerShell.Commands.WebRequestSession\n" +
+				"$session.Cookies.Add((New-Object System.Net.Cookie(\"PHPSESSID\", \"abc123\", \"/\", \".chess.com\")))\n" +
+				"$session.Cookies.Add((New-Object System.Net.Cookie(\"ACCESS_TOKEN\", \"tok\", \"/\", \".chess.com\")))\n" +
+				"Invoke-WebRequest -UseBasicParsing -Uri \"https://www.chess.com/puzzles/rated\" `\n" +
+				"-WebSession $session",
+			want: "PHPSESSID=abc123; ACCESS_TOKEN=tok",
+		},
+		{
+			name:    "no cookie",
+			curl:    `curl 'https://www.chess.com/puzzles/rated' -H 'accept: */*'`,
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			curl:    "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCookieFromCurl(tt.curl)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCookieFromCurl() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCookieFromCurl() error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseCookieFromCurl() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// panickingTransport answers every request with an empty JSON object, except the ones sent with
+// the panic cookie
+type panickingTransport struct{}
+
+func (panickingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Cookie") == "panic" {
+		panic("deliberate test panic")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader("{}")),
+		Request:    req,
+	}, nil
+}
+
+func TestSolveAccountsRecoversFromPanic(t *testing.T) {
+	db := &Database{Accounts: map[string]Account{}}
+	var keys []string
+	for _, username := range []string{"first", "panicking", "second", "third"} {
+		cookie := "PHPSESSID=" + username
+		if username == "panicking" {
+			cookie = "panic"
+		}
+		db.Accounts[username] = Account{Username: username, Cookie: cookie, StrategyName: "default"}
+		keys = append(keys, username)
+	}
+	strategies := map[string]Strategy{"default": {Name: "default", StopMode: StopModePuzzles, PuzzlesPerDay: 1}}
+	client := &http.Client{Transport: panickingTransport{}}
+	appConfig := &AppConfig{MaxConcurrentAccounts: 2}
+
+	var results []ProcessResult
+	captureStdout(t, func() {
+		results = solveAccounts(context.Background(), client, appConfig, &recordingNotifier{}, db, strategies, keys, true)
+	})
+
+	if len(results) != len(keys) {
+		t.Fatalf("got %d results, want %d", len(results), len(keys))
+	}
+	for _, result := range results {
+		if result.AccountUsername == "panicking" {
+			if result.Error == nil || !strings.HasPrefix(result.Error.Error(), "panic:") {
+				t.Errorf("panicking account error = %v, want a panic error", result.Error)
+			}
+			continue
+		}
+		if result.Error != nil {
+			t.Errorf("%s failed: %v", result.AccountUsername, result.Error)
+		}
+		if !result.DryRun {
+			t.Errorf("%s did not complete its dry run", result.AccountUsername)
+		}
+	}
+}
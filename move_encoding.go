@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tcnAlphabet is chess.com's TCN move alphabet: indexes 0-63 are squares (a1, b1, ... h8),
+// the rest encode promotions
+const tcnAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!?{~}(^)[_]@#$,./&-*++="
+
+// tcnPromotionPieces is the order of promotion pieces in the TCN promotion range
+const tcnPromotionPieces = "qnrbkp"
+
+// squareIndex converts a square like "e4" to 0-63 with a1 as 0
+func squareIndex(square string) (int, error) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return 0, fmt.Errorf("invalid square '%s'", square)
+	}
+	return int(square[0]-'a') + int(square[1]-'1')*8, nil
+}
+
+func squareName(index int) string {
+	return string(rune('a'+index%8)) + string(rune('1'+index/8))
+}
+
+// fenPlacement expands the piece placement and side to move of a FEN, indexed like squareIndex
+func fenPlacement(fen string) ([64]byte, string, error) {
+	var board [64]byte
+	fields := strings.Fields(fen)
+	if len(fields) < 2 {
+		return board, "", fmt.Errorf("invalid FEN '%s'", fen)
+	}
+
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return board, "", fmt.Errorf("invalid FEN '%s': expected 8 ranks", fen)
+	}
+	for i, rank := range ranks {
+		file := 0
+		for _, c := range rank {
+			switch {
+			case c >= '1' && c <= '8':
+				file += int(c - '0')
+			case strings.ContainsRune("pnbrqkPNBRQK", c):
+				if file < 8 {
+					board[(7-i)*8+file] = byte(c)
+				}
+				file++
+			default:
+				return board, "", fmt.Errorf("invalid FEN '%s': unexpected '%c'", fen, c)
+			}
+		}
+		if file != 8 {
+			return board, "", fmt.Errorf("invalid FEN '%s': rank %d has %d files", fen, 8-i, file)
+		}
+	}
+
+	if fields[1] != "w" && fields[1] != "b" {
+		return board, "", fmt.Errorf("invalid FEN '%s': bad side to move", fen)
+	}
+	return board, fields[1], nil
+}
+
+// uciToChessComMove translates a UCI move (e.g. "e7e8q") into chess.com's TCN encoding, using the
+// position to check the move belongs to the side to move and to normalize king-takes-rook castling
+func uciToChessComMove(uci string, fen string) (string, error) {
+	if len(uci) != 4 && len(uci) != 5 {
+		return "", fmt.Errorf("invalid UCI move '%s'", uci)
+	}
+	from, err := squareIndex(uci[0:2])
+	if err != nil {
+		return "", err
+	}
+	to, err := squareIndex(uci[2:4])
+	if err != nil {
+		return "", err
+	}
+
+	board, side, err := fenPlacement(fen)
+	if err != nil {
+		return "", err
+	}
+	piece := board[from]
+	if piece == 0 {
+		return "", fmt.Errorf("no piece on %s for move %s", uci[0:2], uci)
+	}
+	isWhite := piece >= 'A' && piece <= 'Z'
+	if isWhite != (side == "w") {
+		return "", fmt.Errorf("move %s moves the opponent's piece", uci)
+	}
+
+	// Some engines castle as king-takes-rook, chess.com expects the king's two-square move
+	target := board[to]
+	if (piece == 'K' || piece == 'k') && (target == piece-'K'+'R') {
+		if to > from {
+			to = from + 2
+		} else {
+			to = from - 2
+		}
+	}
+
+	if len(uci) == 5 {
+		if piece != 'P' && piece != 'p' {
+			return "", fmt.Errorf("move %s promotes a piece that isn't a pawn", uci)
+		}
+		pieceIndex := strings.IndexByte(tcnPromotionPieces, uci[4])
+		if pieceIndex < 0 || uci[4] == 'k' || uci[4] == 'p' {
+			return "", fmt.Errorf("invalid promotion piece in move %s", uci)
+		}
+		fileDelta := to%8 - from%8
+		if fileDelta < -1 || fileDelta > 1 {
+			return "", fmt.Errorf("invalid promotion move %s", uci)
+		}
+		to = 64 + 3*pieceIndex + fileDelta + 1
+	}
+
+	// En passant needs no special handling, TCN only carries the from and to squares
+	return string(tcnAlphabet[from]) + string(tcnAlphabet[to]), nil
+}
+
+// chessComMoveToUCI decodes a single two-character TCN move into UCI notation
+func chessComMoveToUCI(tcn string) (string, error) {
+	if len(tcn) != 2 {
+		return "", fmt.Errorf("invalid TCN move '%s'", tcn)
+	}
+	from := strings.IndexByte(tcnAlphabet, tcn[0])
+	to := strings.IndexByte(tcnAlphabet, tcn[1])
+	if from < 0 || from > 63 || to < 0 || to >= 64+3*len(tcnPromotionPieces) {
+		return "", fmt.Errorf("invalid TCN move '%s'", tcn)
+	}
+
+	promotion := ""
+	if to > 63 {
+		promotion = string(tcnPromotionPieces[(to-64)/3])
+		forward := 8
+		if from < 16 {
+			forward = -8
+		}
+		to = from + forward + (to-1)%3 - 1
+	}
+	return squareName(from) + squareName(to) + promotion, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestUCIToChessComMove(t *testing.T) {
+	const (
+		startFEN     = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+		castlingFEN  = "r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R3K2R w KQkq - 0 1"
+		blackFEN     = "r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R3K2R b KQkq - 0 1"
+		promotionFEN = "8/4P3/8/8/8/8/3p4/k1N1K3 w - - 0 1"
+		blackPromFEN = "8/4P3/8/8/8/8/3p4/k1N1K3 b - - 0 1"
+		enPassantFEN = "rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 3"
+	)
+
+	tests := []struct {
+		name    string
+		uci     string
+		fen     string
+		want    string // TCN
+		decoded string // UCI decoded back from the TCN, the input when empty
+		wantErr bool
+	}{
+		{name: "pawn push", uci: "e2e4", fen: startFEN, want: "mC"},
+		{name: "knight", uci: "g1f3", fen: startFEN, want: "gv"},
+		{name: "white short castle", uci: "e1g1", fen: castlingFEN, want: "eg"},
+		{name: "white long castle", uci: "e1c1", fen: castlingFEN, want: "ec"},
+		{name: "castle as king takes rook", uci: "e1h1", fen: castlingFEN, want: "eg", decoded: "e1g1"},
+		{name: "black short castle", uci: "e8g8", fen: blackFEN, want: "8!"},
+		{name: "black castle as king takes rook", uci: "e8a8", fen: blackFEN, want: "86", decoded: "e8c8"},
+		{name: "queen promotion", uci: "e7e8q", fen: promotionFEN, want: "0~"},
+		{name: "knight promotion", uci: "e7e8n", fen: promotionFEN, want: "0^"},
+		{name: "black capture promotion", uci: "d2c1n", fen: blackPromFEN, want: "l("},
+		{name: "black rook promotion", uci: "d2d1r", fen: blackPromFEN, want: "l_"},
+		{name: "en passant", uci: "e5d6", fen: enPassantFEN, want: "KR"},
+		{name: "opponent's piece", uci: "e7e5", fen: startFEN, wantErr: true},
+		{name: "empty square", uci: "e4e5", fen: startFEN, wantErr: true},
+		{name: "promoting a knight", uci: "c1d3q", fen: promotionFEN, wantErr: true},
+		{name: "promoting to a king", uci: "e7e8k", fen: promotionFEN, wantErr: true},
+		{name: "bad square", uci: "e2e9", fen: startFEN, wantErr: true},
+		{name: "bad FEN", uci: "e2e4", fen: "not a fen", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uciToChessComMove(tt.uci, tt.fen)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("uciToChessComMove(%q) = %q, want an error", tt.uci, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("uciToChessComMove(%q) error: %v", tt.uci, err)
+			}
+			if got != tt.want {
+				t.Fatalf("uciToChessComMove(%q) = %q, want %q", tt.uci, got, tt.want)
+			}
+
+			decoded, err := chessComMoveToUCI(got)
+			if err != nil {
+				t.Fatalf("chessComMoveToUCI(%q) error: %v", got, err)
+			}
+			want := tt.decoded
+			if want == "" {
+				want = tt.uci
+			}
+			if decoded != want {
+				t.Errorf("chessComMoveToUCI(%q) = %q, want %q", got, decoded, want)
+			}
+		})
+	}
+}
+
+func TestChessComMoveToUCIRejectsInvalid(t *testing.T) {
+	for _, tcn := range []string{"", "m", "mCm", "m ", "=m"} {
+		if uci, err := chessComMoveToUCI(tcn); err == nil {
+			t.Errorf("chessComMoveToUCI(%q) = %q, want an error", tcn, uci)
+		}
+	}
+}
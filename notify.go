@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Notifier delivers run events (start, per-account reports, summaries) somewhere
+type Notifier interface {
+	Send(payload WebhookPayload) error
+}
+
+// EditableNotifier is a notifier whose messages can be updated in place after sending
+type EditableNotifier interface {
+	Notifier
+	SendEditable(payload WebhookPayload) (messageID string, err error)
+	Edit(messageID string, payload WebhookPayload) error
+}
+
+// WebhookTarget is a configured notification destination
+type WebhookTarget struct {
+	Type string `json:"type"` // "discord" or "slack"
+	URL  string `json:"url"`
+}
+
+// DiscordNotifier posts payloads to a Discord webhook
+type DiscordNotifier struct {
+	URL string
+}
+
+func (n *DiscordNotifier) Send(payload WebhookPayload) error {
+	return SendWebhook(n.URL, payload)
+}
+
+func (n *DiscordNotifier) SendEditable(payload WebhookPayload) (string, error) {
+	payload.Embeds = fitEmbeds(payload.Embeds...)
+	return PostWebhookMessage(n.URL, payload)
+}
+
+func (n *DiscordNotifier) Edit(messageID string, payload WebhookPayload) error {
+	payload.Embeds = fitEmbeds(payload.Embeds...)
+	return EditWebhookMessage(n.URL, messageID, payload)
+}
+
+// SlackNotifier posts payloads to a Slack incoming webhook, converting embeds to attachments
+type SlackNotifier struct {
+	URL string
+}
+
+type slackPayload struct {
+	Text        string            `json:"text,omitempty"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color    string       `json:"color,omitempty"`
+	Title    string       `json:"title,omitempty"`
+	Text     string       `json:"text,omitempty"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Footer   string       `json:"footer,omitempty"`
+	Fallback string       `json:"fallback,omitempty"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+func (n *SlackNotifier) Send(payload WebhookPayload) error {
+	if !strings.HasPrefix(n.URL, "https://hooks.slack.com/") {
+		logger.Debugf("Slack webhook URL is not set correctly, skipping webhook send.\n")
+		return nil
+	}
+
+	message := slackPayload{Text: stripDiscordMentions(payload.Content)}
+	for _, embed := range payload.Embeds {
+		attachment := slackAttachment{
+			Color:    fmt.Sprintf("#%06x", embed.Color),
+			Title:    embed.Title,
+			Text:     embed.Description,
+			Fallback: embed.Title,
+		}
+		if embed.Footer != nil {
+			attachment.Footer = embed.Footer.Text
+		}
+		for _, field := range embed.Fields {
+			attachment.Fields = append(attachment.Fields, slackField{Title: field.Name, Value: field.Value, Short: field.Inline})
+		}
+		message.Attachments = append(message.Attachments, attachment)
+	}
+
+	payloadJSON, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", n.URL, bytes.NewBuffer(payloadJSON))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if len(payload.Embeds) > 0 {
+		logger.Debugf("Sending slack webhook for: %s\n", payload.Embeds[0].Title)
+	}
+
+	client := newHTTPClient(nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Errorf("Error sending slack webhook: %v\n", err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		logger.Errorf("Slack webhook failed with %s: %s\n", resp.Status, string(body))
+		return fmt.Errorf("slack webhook failed: %s", resp.Status)
+	}
+
+	return nil
+}
+
+var discordMentionPattern = regexp.MustCompile(`<@[!&]?\d+>`)
+
+// stripDiscordMentions removes Discord role/user mentions, which mean nothing on other platforms
+func stripDiscordMentions(content string) string {
+	return strings.TrimSpace(discordMentionPattern.ReplaceAllString(content, ""))
+}
+
+// MultiNotifier fans every payload out to all of its notifiers
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Send(payload WebhookPayload) error {
+	var errs []error
+	for _, notifier := range m {
+		if err := notifier.Send(payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newNotifier builds a notifier for every configured webhook target, including the legacy
+// discord_webhook_url setting
+func newNotifier(config *AppConfig) Notifier {
+	var notifiers MultiNotifier
+	if config.DiscordWebhookURL != "" || len(config.Webhooks) == 0 {
+		// An empty URL still goes through SendWebhook so the "not set" warning is shown
+		notifiers = append(notifiers, &DiscordNotifier{URL: config.DiscordWebhookURL})
+	}
+	for _, target := range config.Webhooks {
+		switch strings.ToLower(target.Type) {
+		case "discord", "":
+			notifiers = append(notifiers, &DiscordNotifier{URL: target.URL})
+		case "slack":
+			notifiers = append(notifiers, &SlackNotifier{URL: target.URL})
+		default:
+			logger.Warnf("Unknown webhook type '%s' for %s, skipping it.\n", target.Type, target.URL)
+		}
+	}
+	return notifiers
+}
+
+const telegramMessageLimit = 4096
+
+// TelegramNotifier sends payloads as Markdown messages through the Telegram Bot API
+type TelegramNotifier struct {
+	BotToken string
+	ChatID   string
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+var telegramMarkdownEscaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// formatTelegramMarkdown renders the payload in Telegram's legacy Markdown
+func formatTelegramMarkdown(payload WebhookPayload) string {
+	var b strings.Builder
+	if content := stripDiscordMentions(payload.Content); content != "" {
+		b.WriteString(telegramMarkdownEscaper.Replace(content))
+		b.WriteString("\n\n")
+	}
+	for _, embed := range payload.Embeds {
+		if embed.Title != "" {
+			b.WriteString("*" + telegramMarkdownEscaper.Replace(embed.Title) + "*\n")
+		}
+		if embed.Description != "" {
+			b.WriteString(telegramMarkdownEscaper.Replace(embed.Description) + "\n")
+		}
+		for _, field := range embed.Fields {
+			b.WriteString("\n*" + telegramMarkdownEscaper.Replace(field.Name) + "*\n")
+			b.WriteString(telegramMarkdownEscaper.Replace(field.Value) + "\n")
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// splitTelegramMessage splits text into chunks within Telegram's message limit, on line boundaries where possible
+func splitTelegramMessage(text string) []string {
+	var chunks []string
+	var current strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		for len([]rune(line)) > telegramMessageLimit {
+			if current.Len() > 0 {
+				chunks = append(chunks, current.String())
+				current.Reset()
+			}
+			runes := []rune(line)
+			chunks = append(chunks, string(runes[:telegramMessageLimit]))
+			line = string(runes[telegramMessageLimit:])
+		}
+		if current.Len() > 0 && len([]rune(current.String()))+1+len([]rune(line)) > telegramMessageLimit {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+func (n *TelegramNotifier) Send(payload WebhookPayload) error {
+	if n.BotToken == "" || n.ChatID == "" {
+		return nil
+	}
+
+	if len(payload.Embeds) > 0 {
+		logger.Debugf("Sending telegram message for: %s\n", payload.Embeds[0].Title)
+	}
+
+	for _, chunk := range splitTelegramMessage(formatTelegramMarkdown(payload)) {
+		if err := n.sendMessage(chunk); err != nil {
+			logger.Errorf("Error sending telegram message: %v\n", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *TelegramNotifier) sendMessage(text string) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id":    n.ChatID,
+		"text":       text,
+		"parse_mode": "Markdown",
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.BotToken)
+	client := newHTTPClient(nil)
+	for attempt := 1; attempt <= 3; attempt++ {
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		var result telegramResponse
+		if err := json.Unmarshal(respBody, &result); err != nil {
+			return fmt.Errorf("unexpected telegram response (%s)", resp.Status)
+		}
+		if result.OK {
+			return nil
+		}
+		if result.ErrorCode == http.StatusTooManyRequests && result.Parameters.RetryAfter > 0 {
+			time.Sleep(time.Duration(result.Parameters.RetryAfter) * time.Second)
+			continue
+		}
+		return fmt.Errorf("telegram error %d: %s", result.ErrorCode, result.Description)
+	}
+	return errors.New("telegram still rate limited after 3 attempts")
+}
+
+// newSummaryNotifier is newNotifier plus the targets that only receive end-of-run summaries
+func newSummaryNotifier(config *AppConfig) Notifier {
+	notifiers := MultiNotifier{newNotifier(config)}
+	if config.TelegramBotToken != "" && config.TelegramChatID != "" {
+		notifiers = append(notifiers, &TelegramNotifier{BotToken: config.TelegramBotToken, ChatID: config.TelegramChatID})
+	}
+	return notifiers
+}
+
+// ProgressUpdater keeps a single progress message per notifier up to date, editing it where
+// the notifier supports that and posting new messages otherwise
+type ProgressUpdater struct {
+	notifiers  []Notifier
+	messageIDs map[Notifier]string
+}
+
+func NewProgressUpdater(notifier Notifier) *ProgressUpdater {
+	return &ProgressUpdater{
+		notifiers:  flattenNotifiers(notifier),
+		messageIDs: make(map[Notifier]string),
+	}
+}
+
+func flattenNotifiers(notifier Notifier) []Notifier {
+	multi, ok := notifier.(MultiNotifier)
+	if !ok {
+		return []Notifier{notifier}
+	}
+	var flat []Notifier
+	for _, n := range multi {
+		flat = append(flat, flattenNotifiers(n)...)
+	}
+	return flat
+}
+
+func (p *ProgressUpdater) Update(payload WebhookPayload) {
+	for _, notifier := range p.notifiers {
+		editable, ok := notifier.(EditableNotifier)
+		if !ok {
+			notifier.Send(payload)
+			continue
+		}
+		if id, ok := p.messageIDs[notifier]; ok {
+			if err := editable.Edit(id, payload); err == nil {
+				continue
+			}
+		}
+		id, err := editable.SendEditable(payload)
+		if err != nil {
+			// Editing isn't available (e.g. the URL isn't set), fall back to a plain message
+			notifier.Send(payload)
+			continue
+		}
+		p.messageIDs[notifier] = id
+	}
+}
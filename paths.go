@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// appDirName is the directory under the user config dir that files are kept in by default
+const appDirName = "chesshook2"
+
+// Resolved by resolvePaths before any command runs
+var (
+	dbPath             = "db.json"
+	configPath         = "config.json"
+	strategiesPath     = "strategies.json"
+	gameStrategiesPath = "game_strategies.json"
+	historyPath        = "history.jsonl"
+	enginePasskeyPath  = "engine_passkey.txt" // Where the engine server passkey is kept between restarts
+)
+
+var (
+	dbPathFlag         string
+	configPathFlag     string
+	strategiesPathFlag string
+)
+
+// resolvePaths works out where every file lives. The db, config and strategies paths come from
+// their flag, then their CHESSHOOK_* environment variable, then the default location
+func resolvePaths() {
+	dbPath = resolvePath(dbPathFlag, "CHESSHOOK_DB", "db.json")
+	configPath = resolvePath(configPathFlag, "CHESSHOOK_CONFIG", "config.json")
+	strategiesPath = resolvePath(strategiesPathFlag, "CHESSHOOK_STRATEGIES", "strategies.json")
+	gameStrategiesPath = defaultPath("game_strategies.json")
+	historyPath = defaultPath("history.jsonl")
+	enginePasskeyPath = defaultPath("engine_passkey.txt")
+}
+
+func resolvePath(flagValue, envVar, name string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if value := os.Getenv(envVar); value != "" {
+		return value
+	}
+	return defaultPath(name)
+}
+
+// defaultPath places a file in the per-user config dir. A file that already exists in the working
+// directory keeps being used from there, so setups from before the config dir don't move
+func defaultPath(name string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return name
+	}
+	dir := filepath.Join(configDir, appDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return name
+	}
+	return filepath.Join(dir, name)
+}
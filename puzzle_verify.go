@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultEnginePath = "stockfish"
+	// verifyDepth is the search depth used to check each solution move
+	verifyDepth = 18
+)
+
+var (
+	verifyEngine     *ChessEngine
+	verifyEngineErr  error
+	verifyEngineOnce sync.Once
+)
+
+// sharedVerifyEngine starts the engine used for puzzle verification on first use, it is shared by
+// all accounts and kept running for the rest of the process
+func sharedVerifyEngine(appConfig *AppConfig) (*ChessEngine, error) {
+	verifyEngineOnce.Do(func() {
+		path := appConfig.EnginePath
+		if path == "" {
+			path = defaultEnginePath
+		}
+		engine := NewChessEngine(path, 2, 64, 1, verifyDepth)
+		if err := engine.Start(); err != nil {
+			verifyEngineErr = fmt.Errorf("failed to start verification engine: %w", err)
+			return
+		}
+		verifyEngine = engine
+	})
+	return verifyEngine, verifyEngineErr
+}
+
+// puzzleStartFEN returns the puzzle's starting position, trying the fields chess.com may put it in
+func puzzleStartFEN(puzzleResp *GetRatedNextResponse) (string, error) {
+	puzzle := puzzleResp.UserPuzzle.Puzzle
+	for _, candidate := range []string{puzzle.UserPosition, puzzle.Fen4} {
+		if _, err := ParseFEN(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("puzzle %s has no usable starting FEN", puzzle.LegacyPuzzleID)
+}
+
+// verifyPuzzleSolution has the engine play our side of the puzzle and compares its moves with the
+// provided solution, returning a description of the first mismatch or "" when they agree
+func verifyPuzzleSolution(engine *ChessEngine, puzzleResp *GetRatedNextResponse) (string, error) {
+	fen, err := puzzleStartFEN(puzzleResp)
+	if err != nil {
+		return "", err
+	}
+	board, err := ParseFEN(fen)
+	if err != nil {
+		return "", err
+	}
+
+	for i, m := range puzzleResp.UserPuzzle.Puzzle.Moves {
+		expected := m.Move.From + m.Move.To
+		if i%2 == 0 {
+			analysis, err := engine.AnalyzePositionToDepth(board.FEN(), 0, verifyDepth)
+			if err != nil {
+				return "", err
+			}
+			// The provided moves don't carry promotions, so only compare the squares
+			if !strings.HasPrefix(analysis.BestMove, expected) {
+				return fmt.Sprintf("move %d: engine plays %s, solution has %s", i+1, analysis.BestMove, expected), nil
+			}
+		}
+
+		if err := board.ApplyUCI(expected); err != nil {
+			// A pawn reaching the last rank, assume the usual queen promotion
+			if err := board.ApplyUCI(expected + "q"); err != nil {
+				return "", fmt.Errorf("solution move %d (%s) is illegal: %w", i+1, expected, err)
+			}
+		}
+	}
+
+	return "", nil
+}
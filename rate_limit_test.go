@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when advanced
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bucket := newTokenBucket(2, 3, clock.Now)
+
+	steps := []struct {
+		advance time.Duration
+		want    bool
+	}{
+		// A full bucket allows the whole burst at once
+		{0, true},
+		{0, true},
+		{0, true},
+		{0, false},
+		// 2 tokens per second, so a quarter second isn't enough for one
+		{250 * time.Millisecond, false},
+		{250 * time.Millisecond, true},
+		{0, false},
+		{time.Second, true},
+		{0, true},
+		{0, false},
+		// Refills stop at the burst size
+		{time.Hour, true},
+		{0, true},
+		{0, true},
+		{0, false},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		if got := bucket.Allow(); got != step.want {
+			t.Fatalf("step %d (after %v): Allow() = %v, want %v", i, step.advance, got, step.want)
+		}
+	}
+}
+
+func TestTokenBucketBurstAtLeastOne(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	bucket := newTokenBucket(1, 0, clock.Now)
+	if !bucket.Allow() {
+		t.Fatal("first Allow() = false, want true")
+	}
+	if bucket.Allow() {
+		t.Fatal("second Allow() = true, want false")
+	}
+	clock.Advance(time.Second)
+	if !bucket.Allow() {
+		t.Fatal("Allow() after a second = false, want true")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// LoadedConfig is config.json and strategies.json as loaded together
+type LoadedConfig struct {
+	App        *AppConfig
+	Strategies map[string]Strategy
+	LoadedAt   time.Time
+}
+
+// ConfigStore holds the config files for long running commands. Runs take the current config when
+// they start, so a reload only affects the runs after it
+type ConfigStore struct {
+	current atomic.Pointer[LoadedConfig]
+	mu      sync.Mutex // Serializes reloads
+}
+
+// NewConfigStore loads config.json and strategies.json into a new store
+func NewConfigStore() (*ConfigStore, error) {
+	store := &ConfigStore{}
+	if _, err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Current returns the config in use, nil when it never loaded
+func (c *ConfigStore) Current() *LoadedConfig {
+	return c.current.Load()
+}
+
+// Reload reads both files again and swaps them in together. When either doesn't load or isn't
+// valid, the config in use is kept and the error returned
+func (c *ConfigStore) Reload() (*LoadedConfig, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	appConfig, err := loadAppConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load app config: %w", err)
+	}
+	strategies, err := loadStrategies(strategiesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load strategies: %w", err)
+	}
+
+	loaded := &LoadedConfig{App: appConfig, Strategies: strategies, LoadedAt: time.Now()}
+	c.current.Store(loaded)
+	return loaded, nil
+}
+
+// ReloadOnSignal reloads the store whenever the process gets SIGHUP, until ctx is done
+func (c *ConfigStore) ReloadOnSignal(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if loaded, err := c.Reload(); err != nil {
+					logger.Errorf("Reload on SIGHUP failed, keeping the current config: %v\n", err)
+				} else {
+					logger.Infof("Reloaded config.json and %d strategies on SIGHUP.\n", len(loaded.Strategies))
+				}
+			}
+		}
+	}()
+}
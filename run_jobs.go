@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Run job statuses
+const (
+	RunJobRunning   = "running"
+	RunJobDone      = "done"
+	RunJobFailed    = "failed"
+	RunJobCancelled = "cancelled"
+)
+
+// ErrRunInProgress is returned when a run is started while another one is still going, as both
+// would load and save db.json
+var ErrRunInProgress = errors.New("a run is already in progress")
+
+// ErrRunNotFound and ErrRunFinished are returned when cancelling a run that can't be cancelled
+var (
+	ErrRunNotFound = errors.New("run not found")
+	ErrRunFinished = errors.New("run already finished")
+)
+
+// RunJobRequest starts a run of all selected accounts, or of one account when Username is set
+type RunJobRequest struct {
+	Username       string   `json:"username,omitempty"` // Only for /api/run/one
+	Accounts       []string `json:"accounts,omitempty"`
+	Strategy       string   `json:"strategy,omitempty"`
+	MinRating      int      `json:"minRating,omitempty"`
+	MaxRating      int      `json:"maxRating,omitempty"`
+	IncludeUnrated bool     `json:"includeUnrated,omitempty"`
+	DryRun         bool     `json:"dryRun,omitempty"`
+	Force          bool     `json:"force,omitempty"`   // Ignore the cooldown, only for /api/run/one
+	Retries        *int     `json:"retries,omitempty"` // Defaults to 1 like `run --retries`
+	Timeout        string   `json:"timeout,omitempty"` // e.g. "2h", defaults to max_run_duration
+}
+
+// RunJobResult is a ProcessResult in a form that can be sent as JSON
+type RunJobResult struct {
+	Username      string `json:"username"`
+	Strategy      string `json:"strategy,omitempty"`
+	PuzzlesSolved int    `json:"puzzlesSolved"`
+	InitialRating int    `json:"initialRating,omitempty"`
+	FinalRating   int    `json:"finalRating,omitempty"`
+	Retries       int    `json:"retries,omitempty"`
+	DryRun        bool   `json:"dryRun,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// RunJob is a run started through the UI server
+type RunJob struct {
+	ID         string         `json:"id"`
+	Username   string         `json:"username,omitempty"` // Set for single account runs
+	DryRun     bool           `json:"dryRun,omitempty"`
+	Status     string         `json:"status"`
+	StartedAt  time.Time      `json:"startedAt"`
+	FinishedAt *time.Time     `json:"finishedAt,omitempty"`
+	Error      string         `json:"error,omitempty"`
+	Results    []RunJobResult `json:"results,omitempty"`
+
+	cancel context.CancelFunc // Stops the run, the accounts finished so far are still saved
+}
+
+// RunJobs starts runs in the background, one at a time, and keeps their outcome for polling. The
+// runs are stopped when ctx, the UI server's lifetime, is done
+type RunJobs struct {
+	mu      sync.Mutex
+	jobs    map[string]*RunJob
+	active  string
+	configs *ConfigStore
+	ctx     context.Context
+	running sync.WaitGroup
+}
+
+func NewRunJobs(ctx context.Context, configs *ConfigStore) *RunJobs {
+	return &RunJobs{jobs: make(map[string]*RunJob), configs: configs, ctx: ctx}
+}
+
+// Start validates the request and starts the run in the background, returning a copy of the new job
+func (j *RunJobs) Start(request RunJobRequest) (RunJob, error) {
+	retries := 1
+	if request.Retries != nil {
+		retries = *request.Retries
+	}
+	var timeout time.Duration
+	if request.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(request.Timeout); err != nil {
+			return RunJob{}, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	options := RunOptions{
+		Selection: RunSelection{
+			Usernames:      request.Accounts,
+			Strategy:       request.Strategy,
+			MinRating:      request.MinRating,
+			MaxRating:      request.MaxRating,
+			IncludeUnrated: request.IncludeUnrated,
+		},
+		DryRun:  request.DryRun,
+		Retries: retries,
+		Timeout: timeout,
+	}
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return RunJob{}, fmt.Errorf("failed to generate job ID: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.active != "" {
+		return RunJob{}, fmt.Errorf("%w (job %s)", ErrRunInProgress, j.active)
+	}
+
+	job := &RunJob{
+		ID:        hex.EncodeToString(idBytes),
+		Username:  request.Username,
+		DryRun:    request.DryRun,
+		Status:    RunJobRunning,
+		StartedAt: time.Now(),
+	}
+	ctx, cancel := context.WithCancel(j.ctx)
+	job.cancel = cancel
+	j.jobs[job.ID] = job
+	j.active = job.ID
+
+	j.running.Add(1)
+	go func() {
+		defer j.running.Done()
+		defer cancel()
+		results, err := runJob(ctx, j.configs, request, options)
+		j.finish(job.ID, results, err, ctx.Err() != nil)
+	}()
+	return *job, nil
+}
+
+// Cancel stops a running job. It finishes in the background, saving the accounts run so far
+func (j *RunJobs) Cancel(id string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return ErrRunNotFound
+	}
+	if job.Status != RunJobRunning {
+		return ErrRunFinished
+	}
+	job.cancel()
+	return nil
+}
+
+// Wait waits for the running job to finish, or for ctx to be done
+func (j *RunJobs) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		j.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runJob runs the accounts with the current config files and saves db.json, the same as `run`
+// and `runOne`
+func runJob(ctx context.Context, configs *ConfigStore, request RunJobRequest, options RunOptions) ([]ProcessResult, error) {
+	loaded := configs.Current()
+	if loaded == nil {
+		// The files didn't load when the server started, they may have been fixed since
+		var err error
+		if loaded, err = configs.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	appConfig, strategies := loaded.App, loaded.Strategies
+
+	db, err := loadDatabase(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load database: %w", err)
+	}
+	// Let the CLI use the database again once the run is over
+	defer unlockDatabase(dbPath)
+
+	var results []ProcessResult
+	if request.Username != "" {
+		result, err := executeRunOne(ctx, appConfig, db, strategies, request.Username, options.DryRun, request.Force)
+		if err != nil {
+			return nil, err
+		}
+		results = []ProcessResult{result}
+	} else {
+		if results, err = executeRun(ctx, appConfig, db, strategies, options); err != nil {
+			return nil, err
+		}
+	}
+
+	if !options.DryRun {
+		if err := saveDatabase(dbPath, db); err != nil {
+			return results, fmt.Errorf("failed to save database: %w", err)
+		}
+	}
+
+	if request.Username != "" {
+		sendRunOneSummary(appConfig, results[0], options.DryRun)
+	} else {
+		sendRunSummary(newSummaryNotifier(appConfig), results, options.DryRun, appConfig.DiscordMentionOnError)
+	}
+	return results, nil
+}
+
+func (j *RunJobs) finish(id string, results []ProcessResult, err error, cancelled bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job := j.jobs[id]
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = RunJobDone
+	if cancelled {
+		job.Status = RunJobCancelled
+	}
+	if err != nil {
+		job.Status = RunJobFailed
+		job.Error = err.Error()
+		logger.Errorf("Run job %s failed: %v\n", id, err)
+	}
+	for _, result := range results {
+		jobResult := RunJobResult{
+			Username:      result.AccountUsername,
+			PuzzlesSolved: result.PuzzlesSolved,
+			InitialRating: result.InitialRating,
+			FinalRating:   result.FinalRating,
+			Retries:       result.Retries,
+			DryRun:        result.DryRun,
+		}
+		if result.Strategy != nil {
+			jobResult.Strategy = result.Strategy.Name
+		}
+		if result.Error != nil {
+			jobResult.Error = result.Error.Error()
+		}
+		job.Results = append(job.Results, jobResult)
+	}
+	j.active = ""
+}
+
+// Get returns a copy of the job with the given ID
+func (j *RunJobs) Get(id string) (RunJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	job, ok := j.jobs[id]
+	if !ok {
+		return RunJob{}, false
+	}
+	return *job, true
+}
+
+// List returns copies of all jobs, newest first
+func (j *RunJobs) List() []RunJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	jobs := make([]RunJob, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return jobs[a].StartedAt.After(jobs[b].StartedAt)
+	})
+	return jobs
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunJobsCancel(t *testing.T) {
+	jobs := NewRunJobs(context.Background(), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	jobs.jobs["abc"] = &RunJob{ID: "abc", Status: RunJobRunning, cancel: cancel}
+	jobs.active = "abc"
+
+	if err := jobs.Cancel("missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("Cancel(missing) = %v, want ErrRunNotFound", err)
+	}
+	if err := jobs.Cancel("abc"); err != nil {
+		t.Fatalf("Cancel(abc) = %v", err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("the job's context wasn't cancelled")
+	}
+
+	jobs.finish("abc", []ProcessResult{{AccountUsername: "alice", PuzzlesSolved: 3}}, nil, ctx.Err() != nil)
+	job, _ := jobs.Get("abc")
+	if job.Status != RunJobCancelled {
+		t.Errorf("status = %q, want %q", job.Status, RunJobCancelled)
+	}
+	if len(job.Results) != 1 || job.Results[0].PuzzlesSolved != 3 {
+		t.Errorf("results = %+v, want the finished account kept", job.Results)
+	}
+	if err := jobs.Cancel("abc"); !errors.Is(err, ErrRunFinished) {
+		t.Errorf("Cancel after finishing = %v, want ErrRunFinished", err)
+	}
+}
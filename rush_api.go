@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// rushServiceURL is the RPC service behind Puzzle Rush, it follows the same conventions as the
+// rated PuzzleService
+const rushServiceURL = "https://www.chess.com/rpc/chesscom.puzzles.v1.PuzzleRushService/"
+
+// Puzzle Rush modes as chess.com names them
+const (
+	RushModeThreeMinutes = "THREE_MINUTES"
+	RushModeFiveMinutes  = "FIVE_MINUTES"
+	RushModeSurvival     = "SURVIVAL"
+)
+
+// RushSession is a started Puzzle Rush
+type RushSession struct {
+	RushID     string `json:"rushId"`
+	Mode       string `json:"mode"`
+	TimeLimit  string `json:"timeLimit"` // e.g. "180s", empty in survival mode
+	MaxStrikes int    `json:"maxStrikes"`
+}
+
+type StartRushResponse struct {
+	Rush RushSession `json:"rush"`
+}
+
+// SubmitRushSolutionResponse is the state of the rush after a solution was submitted
+type SubmitRushSolutionResponse struct {
+	SolutionResult string `json:"solutionResult"`
+	Score          int    `json:"score"`
+	Strikes        int    `json:"strikes"`
+	RushOver       bool   `json:"rushOver"`
+}
+
+// IsSolved reports whether chess.com accepted the submitted solution
+func (r *SubmitRushSolutionResponse) IsSolved() bool {
+	return isPassingResult(r.SolutionResult)
+}
+
+// FinishRushResponse is the final result of a rush
+type FinishRushResponse struct {
+	Score          int  `json:"score"`
+	HighScore      int  `json:"highScore"`
+	IsNewHighScore bool `json:"isNewHighScore"`
+}
+
+type rushSolutionPayload struct {
+	RushID string `json:"rushId"`
+	SolutionPayload
+}
+
+// rushRPC posts payload to a PuzzleRushService method and decodes the response into out
+func rushRPC(ctx context.Context, client *http.Client, headers http.Header, method string, payload any, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", rushServiceURL+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = headers.Clone()
+	req.Header.Set("Referer", "https://www.chess.com/puzzles/rush")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := checkResponse(resp, respBody); err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s failed: %s. Response body: %s", method, resp.Status, summarizeBody(respBody))
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal %s response: %w. Response body: %s", method, err, summarizeBody(respBody))
+	}
+	return nil
+}
+
+// startRush starts a new Puzzle Rush in the given mode
+func startRush(ctx context.Context, client *http.Client, headers http.Header, mode string) (*RushSession, error) {
+	var startResp StartRushResponse
+	if err := rushRPC(ctx, client, headers, "StartRush", map[string]string{"mode": mode}, &startResp); err != nil {
+		return nil, err
+	}
+	if startResp.Rush.RushID == "" {
+		return nil, fmt.Errorf("got empty rush ID")
+	}
+	return &startResp.Rush, nil
+}
+
+// getNextRushPuzzle fetches the next puzzle of a rush, in the same shape as the rated stream
+func getNextRushPuzzle(ctx context.Context, client *http.Client, headers http.Header, rushID string) (*GetRatedNextResponse, error) {
+	var puzzleResp GetRatedNextResponse
+	if err := rushRPC(ctx, client, headers, "GetNextRushPuzzle", map[string]string{"rushId": rushID}, &puzzleResp); err != nil {
+		return nil, err
+	}
+	if puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID == "" {
+		return nil, fmt.Errorf("got empty rush puzzle ID")
+	}
+	return &puzzleResp, nil
+}
+
+// submitRushSolution submits the solution to a rush puzzle, reporting it as solved in attemptDuration
+func submitRushSolution(ctx context.Context, client *http.Client, headers http.Header, rushID string, puzzleResp *GetRatedNextResponse, attemptDuration time.Duration) (*SubmitRushSolutionResponse, error) {
+	var moves []MoveType
+	for _, m := range puzzleResp.UserPuzzle.Puzzle.Moves {
+		moves = append(moves, m.Move)
+	}
+
+	payload := rushSolutionPayload{
+		RushID: rushID,
+		SolutionPayload: SolutionPayload{
+			LegacyPuzzleID:  puzzleResp.UserPuzzle.Puzzle.LegacyPuzzleID,
+			Moves:           moves,
+			AttemptDuration: formatAPIDuration(attemptDuration),
+		},
+	}
+
+	var solutionResp SubmitRushSolutionResponse
+	if err := rushRPC(ctx, client, headers, "SubmitRushSolution", payload, &solutionResp); err != nil {
+		return nil, err
+	}
+	return &solutionResp, nil
+}
+
+// finishRush ends a rush and returns its final score
+func finishRush(ctx context.Context, client *http.Client, headers http.Header, rushID string) (*FinishRushResponse, error) {
+	var finishResp FinishRushResponse
+	if err := rushRPC(ctx, client, headers, "FinishRush", map[string]string{"rushId": rushID}, &finishResp); err != nil {
+		return nil, err
+	}
+	return &finishResp, nil
+}
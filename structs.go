@@ -136,7 +136,7 @@ type SubmitSolutionResponse struct {
 		RatingType     string `json:"ratingType"`
 		PreviousRating int    `json:"previousRating"`
 	} `json:"puzzleRatings"`
-	AttemptDuration float64
+	ReportedDuration time.Duration `json:"-"` // The solve time that was sent, not part of the response
 }
 
 type MembershipStatusResponse struct {
@@ -166,3 +166,18 @@ type MembershipStatusResponse struct {
 	IsFree                bool      `json:"isFree"`
 	HasActiveBilling      bool      `json:"hasActiveBilling"`
 }
+
+// PuzzleAttemptHistoryResponse is one page of an account's rated puzzle attempts, newest first
+type PuzzleAttemptHistoryResponse struct {
+	Attempts      []PuzzleAttempt `json:"attempts"`
+	NextPageToken string          `json:"nextPageToken"`
+}
+
+type PuzzleAttempt struct {
+	LegacyPuzzleID string    `json:"legacyPuzzleId"`
+	PuzzleRating   int       `json:"puzzleRating"`
+	UserRating     int       `json:"userRating"`
+	RatingChange   int       `json:"ratingChange"`
+	SolutionResult string    `json:"solutionResult"`
+	AttemptedAt    time.Time `json:"attemptedAt"`
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPuzzleAttemptHistoryResponseDecodes(t *testing.T) {
+	body, err := os.ReadFile("testdata/puzzle_attempt_history.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page PuzzleAttemptHistoryResponse
+	if err := json.Unmarshal(body, &page); err != nil {
+		t.Fatalf("failed to decode fixture: %v", err)
+	}
+
+	if page.NextPageToken != "CgYxMjM0NTY" {
+		t.Errorf("NextPageToken = %q", page.NextPageToken)
+	}
+	want := []struct {
+		id           string
+		userRating   int
+		ratingChange int
+		passed       bool
+		attemptedAt  time.Time
+	}{
+		{"123456", 1712, 9, true, time.Date(2025, 3, 14, 18, 22, 5, 0, time.UTC)},
+		{"654321", 1703, -14, false, time.Date(2025, 3, 14, 18, 20, 41, 512_000_000, time.UTC)},
+		{"777777", 1717, 0, true, time.Date(2025, 3, 13, 9, 1, 0, 0, time.UTC)},
+	}
+	if len(page.Attempts) != len(want) {
+		t.Fatalf("decoded %d attempts, want %d", len(page.Attempts), len(want))
+	}
+	for i, w := range want {
+		got := page.Attempts[i]
+		if got.LegacyPuzzleID != w.id || got.UserRating != w.userRating || got.RatingChange != w.ratingChange {
+			t.Errorf("attempt %d = %+v, want id %s, rating %d, change %d", i, got, w.id, w.userRating, w.ratingChange)
+		}
+		if got.Passed() != w.passed {
+			t.Errorf("attempt %d Passed() = %v, want %v", i, got.Passed(), w.passed)
+		}
+		if !got.AttemptedAt.Equal(w.attemptedAt) {
+			t.Errorf("attempt %d AttemptedAt = %v, want %v", i, got.AttemptedAt, w.attemptedAt)
+		}
+	}
+}
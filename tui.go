@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	dashboardRefresh    = 250 * time.Millisecond // How often the dashboard is redrawn
+	dashboardLogLines   = 8                      // Log lines kept below the account table
+	dashboardEventWidth = 60                     // Longer last events are cut off so rows don't wrap
+)
+
+// Account statuses shown on the dashboard
+const (
+	DashboardQueued  = "queued"
+	DashboardRunning = "running"
+	DashboardDone    = "done"
+	DashboardFailed  = "failed"
+)
+
+// DashboardRow is one account's line on the dashboard
+type DashboardRow struct {
+	Username  string
+	Strategy  *Strategy
+	Solved    int
+	Rating    int
+	Status    string
+	LastEvent string
+}
+
+// Dashboard is a full screen view of a run with a row per account, redrawn in place. While it is
+// running the logger hands it persistent lines as the accounts' last events and everything else
+// as log lines
+type Dashboard struct {
+	mu      sync.Mutex
+	rows    map[string]*DashboardRow
+	order   []string
+	logs    []string
+	started time.Time
+	done    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// StartDashboard switches the terminal to the dashboard and routes the logger's output to it. The
+// logger holds it until Stop, see Logger.Dashboard
+func StartDashboard(usernames []string) *Dashboard {
+	d := &Dashboard{
+		rows:    make(map[string]*DashboardRow),
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	for _, username := range usernames {
+		d.row(username).Status = DashboardQueued
+	}
+
+	// Alternate screen and hidden cursor, restored by Stop
+	fmt.Print("\033[?1049h\033[?25l")
+	logger.SetDashboard(d)
+
+	d.stopped.Add(1)
+	go d.loop()
+	return d
+}
+
+// Stop restores the terminal and prints the final table, so it stays visible after the run
+func (d *Dashboard) Stop() {
+	if d == nil {
+		return
+	}
+	d.once.Do(func() {
+		close(d.done)
+		d.stopped.Wait()
+		logger.SetDashboard(nil)
+		fmt.Print("\033[?25h\033[?1049l")
+
+		d.mu.Lock()
+		table := d.table()
+		d.mu.Unlock()
+		logger.Printf("%s", table)
+	})
+}
+
+func (d *Dashboard) loop() {
+	defer d.stopped.Done()
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.redraw()
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// row returns the row for username, adding it at the bottom when it's new. d.mu must be held
+func (d *Dashboard) row(username string) *DashboardRow {
+	row, ok := d.rows[username]
+	if !ok {
+		row = &DashboardRow{Username: username}
+		d.rows[username] = row
+		d.order = append(d.order, username)
+	}
+	return row
+}
+
+// update applies fn to the row for username
+func (d *Dashboard) update(username string, fn func(row *DashboardRow)) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(d.row(username))
+}
+
+// AccountStarted marks the account as running with the given strategy and starting rating
+func (d *Dashboard) AccountStarted(username string, strategy *Strategy, rating int) {
+	d.update(username, func(row *DashboardRow) {
+		row.Strategy = strategy
+		row.Rating = rating
+		row.Solved = 0
+		row.Status = DashboardRunning
+	})
+}
+
+// AccountProgress records a solved puzzle and the rating after it
+func (d *Dashboard) AccountProgress(username string, solved, rating int) {
+	d.update(username, func(row *DashboardRow) {
+		row.Solved = solved
+		if rating > 0 {
+			row.Rating = rating
+		}
+	})
+}
+
+// AccountFinished marks the account as done, or failed when err is set
+func (d *Dashboard) AccountFinished(username string, err error) {
+	d.update(username, func(row *DashboardRow) {
+		row.Status = DashboardDone
+		if err != nil {
+			row.Status = DashboardFailed
+			row.LastEvent = err.Error()
+		}
+	})
+}
+
+// Event sets an account's last event from one of the logger's persistent lines
+func (d *Dashboard) Event(username, text string) {
+	text = strings.TrimPrefix(ansiEscapePattern.ReplaceAllString(text, ""), "["+username+"] ")
+	d.update(username, func(row *DashboardRow) {
+		row.LastEvent = text
+	})
+}
+
+// Log adds output that isn't tied to an account below the table
+func (d *Dashboard) Log(text string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logs = append(d.logs, strings.Split(strings.TrimRight(ansiEscapePattern.ReplaceAllString(text, ""), "\n"), "\n")...)
+	if len(d.logs) > dashboardLogLines {
+		d.logs = d.logs[len(d.logs)-dashboardLogLines:]
+	}
+}
+
+// progress returns a bar for the row, against the rating target in the rating stop modes and
+// against the puzzle count otherwise
+func (row *DashboardRow) progress() string {
+	if row.Strategy == nil {
+		return ProgressBarUtil(0, 1)
+	}
+	switch row.Strategy.StopMode {
+	case StopModeRating:
+		return ProgressBarUtil(row.Rating, row.Strategy.TargetRating)
+	case StopModeRatingFloor:
+		if row.Status == DashboardDone {
+			return ProgressBarUtil(1, 1)
+		}
+		return ProgressBarUtil(0, 1)
+	case StopModeStreak:
+		return ProgressBarUtil(row.Solved, streakPuzzleLimit(row.Strategy))
+	default:
+		return ProgressBarUtil(row.Solved, row.Strategy.PuzzlesPerDay)
+	}
+}
+
+// table renders the account rows. d.mu must be held
+func (d *Dashboard) table() string {
+	var table strings.Builder
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ACCOUNT\tPROGRESS\tSOLVED\tRATING\tSTATUS\tLAST EVENT")
+	for _, username := range d.order {
+		row := d.rows[username]
+		rating := "-"
+		if row.Rating > 0 {
+			rating = fmt.Sprintf("%d", row.Rating)
+		}
+		event := row.LastEvent
+		if runes := []rune(event); len(runes) > dashboardEventWidth {
+			event = string(runes[:dashboardEventWidth-1]) + "…"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\t%s\t%s\n", row.Username, row.progress(), row.Solved, rating, row.Status, event)
+	}
+	writer.Flush()
+	return table.String()
+}
+
+// redraw repaints the screen over the previous frame, clearing each line's leftovers instead of
+// the whole screen so it doesn't flicker
+func (d *Dashboard) redraw() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, row := range d.rows {
+		counts[row.Status]++
+	}
+
+	lines := []string{
+		fmt.Sprintf("chesshook2 run, %s elapsed: %d running, %d queued, %d done, %d failed",
+			time.Since(d.started).Round(time.Second), counts[DashboardRunning], counts[DashboardQueued], counts[DashboardDone], counts[DashboardFailed]),
+		"",
+	}
+	lines = append(lines, strings.Split(strings.TrimSuffix(d.table(), "\n"), "\n")...)
+	if len(d.logs) > 0 {
+		lines = append(lines, "")
+		lines = append(lines, d.logs...)
+	}
+
+	var screen strings.Builder
+	screen.WriteString("\033[H")
+	for _, line := range lines {
+		screen.WriteString(line)
+		screen.WriteString("\033[K\n")
+	}
+	screen.WriteString("\033[J")
+	os.Stdout.WriteString(screen.String())
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// UI passwords are stored as "pbkdf2-sha256$<iterations>$<salt>$<key>", the salt and key in
+// unpadded base64
+const (
+	passwordHashScheme     = "pbkdf2-sha256"
+	passwordHashIterations = 600_000
+	passwordHashSaltSize   = 16
+	passwordHashKeySize    = 32
+)
+
+// hashPassword returns a hash of password for UIConfig.AuthPasswordHash
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, passwordHashSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIterations, passwordHashKeySize)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s$%d$%s$%s", passwordHashScheme, passwordHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// passwordHash is a parsed password hash
+type passwordHash struct {
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+// parsePasswordHash parses a hash made by hashPassword
+func parsePasswordHash(hash string) (*passwordHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return nil, fmt.Errorf("not a %s password hash, make one with `serve hash-password`", passwordHashScheme)
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return nil, fmt.Errorf("invalid iteration count %q", parts[1])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("invalid key")
+	}
+	return &passwordHash{iterations: iterations, salt: salt, key: key}, nil
+}
+
+// matches reports whether password is the one the hash was made from
+func (h *passwordHash) matches(password string) bool {
+	key, err := pbkdf2.Key(sha256.New, password, h.salt, h.iterations, len(h.key))
+	return err == nil && subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// isLoopbackAddress reports whether a listen address like "localhost:3000" only accepts local connections
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// checkAuthConfig validates the configured credentials and refuses a non-local address without them,
+// the API hands out the engine passkey and starts puzzle runs
+func (s *UIServer) checkAuthConfig() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.AuthUser == "" && s.config.AuthPasswordHash == "" {
+		if !isLoopbackAddress(s.address) {
+			return fmt.Errorf("refusing to serve the UI on %s without authentication, set --auth-user and --auth-password-hash or bind to localhost", s.address)
+		}
+		s.authHash = nil
+		return nil
+	}
+	if s.config.AuthUser == "" || s.config.AuthPasswordHash == "" {
+		return fmt.Errorf("both --auth-user and --auth-password-hash are needed for authentication")
+	}
+	hash, err := parsePasswordHash(s.config.AuthPasswordHash)
+	if err != nil {
+		return fmt.Errorf("invalid password hash: %w", err)
+	}
+	s.authHash = hash
+	return nil
+}
+
+// withBasicAuth requires HTTP Basic auth with the configured credentials, when there are any.
+// Checking a password is slow on purpose, so credentials that passed are remembered by their digest
+func (s *UIServer) withBasicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.RLock()
+		hash, user := s.authHash, s.config.AuthUser
+		s.mu.RUnlock()
+		if hash == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if ok && subtle.ConstantTimeCompare([]byte(username), []byte(user)) == 1 {
+			digest := sha256.Sum256([]byte(password))
+			if _, verified := s.authVerified.Load(digest); verified {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if hash.matches(password) {
+				s.authVerified.Store(digest, true)
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Basic realm="ChessHook", charset="UTF-8"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	})
+}
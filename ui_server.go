@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -22,6 +26,13 @@ type UIServer struct {
 	mu           sync.RWMutex
 	running      bool
 	config       *UIConfig
+	configs      *ConfigStore // config.json and strategies.json for runs started from the UI
+	runJobs      *RunJobs
+	ctx          context.Context    // Done once the server shuts down, stopping its runs
+	stop         context.CancelFunc // Cancels ctx
+	httpServer   *http.Server
+	authHash     *passwordHash // Parsed AuthPasswordHash, nil when no credentials are configured
+	authVerified sync.Map      // Digests of passwords that matched authHash
 }
 
 // UIConfig represents the UI and engine configuration
@@ -31,16 +42,44 @@ type UIConfig struct {
 	Hash            int    `json:"hash"`
 	Depth           int    `json:"depth"`
 	MultiPV         int    `json:"multipv"`
+	SyzygyPath      string `json:"syzygyPath"`
 	Address         string `json:"address"`
 	AuthWrite       bool   `json:"authWrite"`
 	LocalhostBypass bool   `json:"localhostBypass"`
 	Passkey         string `json:"passkey"`
+	CommandRate     int    `json:"commandRate"` // position/go commands per second per client, 0 for no limit
+	CommandBurst    int    `json:"commandBurst"`
+	MaxMoveTimeMs   int    `json:"maxMoveTimeMs"` // Longest go movetime a client may ask for
+	// Origins allowed to call the API from a browser, e.g. http://localhost:5173, or "*" for any.
+	// Empty by default, so only pages served by the UI server itself can use it
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	// HTTP Basic auth credentials for every route, required when not bound to localhost. Never
+	// sent to the browser
+	AuthUser         string `json:"-"`
+	AuthPasswordHash string `json:"-"` // Made by `serve hash-password`
 }
 
 // NewUIServer creates a new UI server
 func NewUIServer(address string) *UIServer {
+	passKey, err := loadPasskey(enginePasskeyPath)
+	if err != nil {
+		logger.Warnf("Could not load the saved engine passkey, a new one will be generated: %v\n", err)
+	}
+
+	configs, err := NewConfigStore()
+	if err != nil {
+		// The UI and engine server work without them, runs load them again when started
+		logger.Warnf("Could not load the config files, puzzle runs won't work until they are fixed: %v\n", err)
+		configs = &ConfigStore{}
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
 	return &UIServer{
 		address: address,
+		configs: configs,
+		runJobs: NewRunJobs(ctx, configs),
+		ctx:     ctx,
+		stop:    stop,
 		config: &UIConfig{
 			EnginePath:      "stockfish",
 			Threads:         4,
@@ -50,22 +89,148 @@ func NewUIServer(address string) *UIServer {
 			Address:         "localhost:8080",
 			AuthWrite:       true,
 			LocalhostBypass: true,
+			Passkey:         passKey,
+			CommandRate:     10,
+			CommandBurst:    20,
+			MaxMoveTimeMs:   int(defaultMaxMoveTime.Milliseconds()),
 		},
 	}
 }
 
-// Start starts the UI server
+// Start starts the UI server and serves until Shutdown is called
 func (s *UIServer) Start() error {
+	if err := s.checkAuthConfig(); err != nil {
+		logger.Errorf("⚠️  %v\n", err)
+		return err
+	}
 	logger.Printf("Starting UI server on %s\n", s.address)
 
-	// Setup routes
-	http.HandleFunc("/", s.handleIndex)
-	http.HandleFunc("/api/config", s.handleConfig)
-	http.HandleFunc("/api/userscript", s.handleUserscript)
-	http.HandleFunc("/api/server/start", s.handleServerStart)
-	http.HandleFunc("/api/server/stop", s.handleServerStop)
+	// Setup routes on a mux of our own, so the engine server can run in the same process
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/api/config", s.handleConfig)
+	mux.HandleFunc("/api/userscript", s.handleUserscript)
+	mux.HandleFunc("/api/server/start", s.handleServerStart)
+	mux.HandleFunc("/api/server/stop", s.handleServerStop)
+	mux.HandleFunc("/api/server/status", s.handleServerStatus)
+	mux.HandleFunc("/api/server/rotate-passkey", s.handleRotatePasskey)
+	mux.HandleFunc("/api/run", s.handleRun)
+	mux.HandleFunc("/api/run/one", s.handleRunOne)
+	mux.HandleFunc("/api/run/{id}", s.handleRunStatus)
+	mux.HandleFunc("/api/run/{id}/cancel", s.handleRunCancel)
+	mux.HandleFunc("/api/reload", s.handleReload)
+
+	s.configs.ReloadOnSignal(s.ctx)
+
+	// CORS goes first so preflight requests, which never carry credentials, get answered
+	server := &http.Server{Addr: s.address, Handler: s.withCORS(s.withBasicAuth(mux))}
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return http.ErrServerClosed
+	}
+	s.httpServer = server
+	s.mu.Unlock()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown cancels the running job and waits for it to save db.json, then stops serving. ctx
+// bounds the wait
+func (s *UIServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.stop()
+	server := s.httpServer
+	s.mu.Unlock()
+
+	err := s.runJobs.Wait(ctx)
+	if server != nil {
+		err = errors.Join(err, server.Shutdown(ctx))
+	}
+	return err
+}
+
+// SetAuth sets the credentials required by every route, empty to not require any
+func (s *UIServer) SetAuth(user, passwordHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.AuthUser = user
+	s.config.AuthPasswordHash = passwordHash
+}
+
+// SetAllowedOrigins sets the origins allowed to call the API from a browser
+func (s *UIServer) SetAllowedOrigins(origins []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.AllowedOrigins = origins
+}
+
+// originAllowed reports whether origin is in the config's AllowedOrigins
+func (s *UIServer) originAllowed(origin string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, allowed := range s.config.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether origin is the UI server's own, as reached by r
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
 
-	return http.ListenAndServe(s.address, nil)
+// writeAllowed reports whether r may change state. Browsers send simple cross-site requests, like a
+// text/plain POST from a form, without asking first, so a request that changes state has to come
+// from our own page or an allowed origin, or be JSON, which browsers never send cross-site without a
+// preflight the origin has to pass. Requests that only read are always let through
+func (s *UIServer) writeAllowed(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return sameOrigin(r, origin) || s.originAllowed(origin)
+	}
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// withCORS adds CORS headers for allowed origins and answers their preflight requests. Other
+// origins get no headers, so browsers keep blocking them, and their requests that would change
+// state are refused, see writeAllowed
+func (s *UIServer) withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.writeAllowed(r) {
+			http.Error(w, "Cross-site request refused", http.StatusForbidden)
+			return
+		}
+		origin := r.Header.Get("Origin")
+		if origin == "" || !s.originAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *UIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
@@ -109,6 +274,14 @@ func (s *UIServer) handleConfig(w http.ResponseWriter, r *http.Request) {
 		}
 
 		s.mu.Lock()
+		// The passkey and limits aren't part of the config form
+		newConfig.Passkey = s.config.Passkey
+		newConfig.CommandRate = s.config.CommandRate
+		newConfig.CommandBurst = s.config.CommandBurst
+		newConfig.MaxMoveTimeMs = s.config.MaxMoveTimeMs
+		newConfig.AllowedOrigins = s.config.AllowedOrigins
+		newConfig.AuthUser = s.config.AuthUser
+		newConfig.AuthPasswordHash = s.config.AuthPasswordHash
 		s.config = &newConfig
 		s.mu.Unlock()
 
@@ -127,11 +300,13 @@ func (s *UIServer) handleUserscript(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var reqConfig struct {
-		Engine   string `json:"engine"`
-		AutoMove bool   `json:"autoMove"`
+		Engine     string `json:"engine"`
+		AutoMove   bool   `json:"autoMove"`
 		ArrowColor string `json:"arrowColor"`
-		WsURL    string `json:"wsURL"`
-		PassKey  string `json:"passKey"`
+		WsURL      string `json:"wsURL"`
+		PassKey    string `json:"passKey"`
+		Depth      int    `json:"depth"`
+		MultiPV    int    `json:"multipv"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&reqConfig); err != nil {
@@ -139,13 +314,31 @@ func (s *UIServer) handleUserscript(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Default to what the engine server is configured for
+	s.mu.RLock()
+	if reqConfig.Depth <= 0 {
+		reqConfig.Depth = s.config.Depth
+	}
+	if reqConfig.MultiPV <= 0 {
+		reqConfig.MultiPV = s.config.MultiPV
+	}
+	s.mu.RUnlock()
+
+	arrowColor, err := normalizeArrowColor(reqConfig.ArrowColor)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Generate userscript
 	config := UserscriptConfig{
 		Engine:            reqConfig.Engine,
 		AutoMove:          fmt.Sprintf("%t", reqConfig.AutoMove),
-		ArrowColor:        reqConfig.ArrowColor,
+		ArrowColor:        arrowColor,
 		ExternalEngineURL: reqConfig.WsURL,
 		PassKey:           reqConfig.PassKey,
+		Depth:             reqConfig.Depth,
+		MultiPV:           reqConfig.MultiPV,
 	}
 
 	var builder strings.Builder
@@ -173,6 +366,44 @@ func (s *UIServer) handleServerStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	engineServer, err := s.startEngineServer()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "success",
+		"passkey": engineServer.PassKey(),
+	})
+}
+
+// StartEngineServer starts the engine server in the background with the current config, the same
+// as the UI's start button, and returns its passkey
+func (s *UIServer) StartEngineServer() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return "", fmt.Errorf("engine server already running")
+	}
+	engineServer, err := s.startEngineServer()
+	if err != nil {
+		return "", err
+	}
+	return engineServer.PassKey(), nil
+}
+
+// SetEngineAddress sets the address the engine server listens on once started
+func (s *UIServer) SetEngineAddress(address string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.Address = address
+}
+
+// startEngineServer creates the engine server and starts it in the background. s.mu must be held
+func (s *UIServer) startEngineServer() (*EngineServer, error) {
 	engineConfig := &EngineConfig{
 		Address:         s.config.Address,
 		EnginePath:      s.config.EnginePath,
@@ -180,32 +411,92 @@ func (s *UIServer) handleServerStart(w http.ResponseWriter, r *http.Request) {
 		Hash:            s.config.Hash,
 		MultiPV:         s.config.MultiPV,
 		Depth:           s.config.Depth,
+		SyzygyPath:      s.config.SyzygyPath,
 		RequireAuth:     s.config.AuthWrite,
 		LocalhostBypass: s.config.LocalhostBypass,
+		Passkey:         s.config.Passkey,
+		CommandRate:     float64(s.config.CommandRate),
+		CommandBurst:    s.config.CommandBurst,
+		MaxMoveTimeMs:   s.config.MaxMoveTimeMs,
 	}
 
 	engineServer, err := NewEngineServer(engineConfig)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
 	s.engineServer = engineServer
-	s.config.Passkey = engineServer.passKey
+	if s.config.Passkey == "" {
+		s.config.Passkey = engineServer.PassKey()
+		if err := savePasskey(enginePasskeyPath, s.config.Passkey); err != nil {
+			logger.Warnf("Could not save the engine passkey, it will change on restart: %v\n", err)
+		}
+	}
 
 	// Start in background
 	go func() {
 		if err := engineServer.Start(); err != nil {
-			logger.Printf("Engine server error: %v\n", err)
+			logger.Errorf("Engine server error: %v\n", err)
 		}
 	}()
 
 	s.running = true
+	return engineServer, nil
+}
+
+// handleServerStatus reports whether the engine server is running and where
+func (s *UIServer) handleServerStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.RLock()
+	status := struct {
+		Running bool   `json:"running"`
+		Address string `json:"address,omitempty"`
+	}{Running: s.running}
+	if s.running && s.engineServer != nil {
+		status.Address = s.engineServer.address
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// handleRotatePasskey replaces the engine passkey, making clients of a running server authenticate again
+func (s *UIServer) handleRotatePasskey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var passKey string
+	var err error
+	if s.running && s.engineServer != nil {
+		passKey, err = s.engineServer.RotatePasskey()
+	} else {
+		passKey, err = generatePasskey()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := savePasskey(enginePasskeyPath, passKey); err != nil {
+		http.Error(w, fmt.Sprintf("failed to save passkey: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.config.Passkey = passKey
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "success",
-		"passkey": engineServer.passKey,
+		"passkey": passKey,
 	})
 }
 
@@ -233,3 +524,127 @@ func (s *UIServer) handleServerStop(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
+
+// handleReload reads config.json and strategies.json again for the runs started after it. When they
+// aren't valid the current ones are kept and the error is returned
+func (s *UIServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	loaded, err := s.configs.Reload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	logger.Infof("Reloaded config.json and %d strategies.\n", len(loaded.Strategies))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":     "success",
+		"strategies": len(loaded.Strategies),
+		"loadedAt":   loaded.LoadedAt,
+	})
+}
+
+// handleRun starts a puzzle run of all accounts, or those picked by the filters in the body (POST),
+// or lists the runs started so far (GET)
+func (s *UIServer) handleRun(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.runJobs.List())
+	case http.MethodPost:
+		var request RunJobRequest
+		if err := decodeRunRequest(r, &request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Username = ""
+		s.startRunJob(w, request)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRunOne starts a puzzle run of the account named by username in the body
+func (s *UIServer) handleRunOne(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request RunJobRequest
+	if err := decodeRunRequest(r, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Username == "" {
+		http.Error(w, "username is required", http.StatusBadRequest)
+		return
+	}
+	s.startRunJob(w, request)
+}
+
+// decodeRunRequest reads a RunJobRequest from the body, an empty body being a request with no options
+func decodeRunRequest(r *http.Request, request *RunJobRequest) error {
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil && err != io.EOF {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func (s *UIServer) startRunJob(w http.ResponseWriter, request RunJobRequest) {
+	job, err := s.runJobs.Start(request)
+	if errors.Is(err, ErrRunInProgress) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleRunStatus returns a run's status, and its results once it has finished
+func (s *UIServer) handleRunStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, ok := s.runJobs.Get(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// handleRunCancel stops a running run, the accounts it finished are still saved
+func (s *UIServer) handleRunCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := s.runJobs.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrRunNotFound):
+		http.Error(w, "Run not found", http.StatusNotFound)
+		return
+	case errors.Is(err, ErrRunFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
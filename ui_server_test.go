@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithCORSRefusesCrossSiteWrites(t *testing.T) {
+	s := &UIServer{config: &UIConfig{AllowedOrigins: []string{"https://lichess.org"}}}
+	handler := s.withCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    int
+	}{
+		{"read", http.MethodGet, map[string]string{"Origin": "https://evil.example"}, http.StatusNoContent},
+		{"cross-site form", http.MethodPost, map[string]string{"Origin": "https://evil.example", "Content-Type": "text/plain"}, http.StatusForbidden},
+		{"cross-site json", http.MethodPost, map[string]string{"Origin": "https://evil.example", "Content-Type": "application/json"}, http.StatusForbidden},
+		{"no origin form", http.MethodPost, map[string]string{"Content-Type": "text/plain"}, http.StatusForbidden},
+		{"cross-site fetch metadata", http.MethodPost, map[string]string{"Sec-Fetch-Site": "cross-site", "Content-Type": "application/json"}, http.StatusForbidden},
+		{"no origin json", http.MethodPost, map[string]string{"Content-Type": "application/json; charset=utf-8"}, http.StatusNoContent},
+		{"same origin", http.MethodPost, map[string]string{"Origin": "http://localhost:8080"}, http.StatusNoContent},
+		{"same origin fetch metadata", http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"}, http.StatusNoContent},
+		{"allowed origin", http.MethodPost, map[string]string{"Origin": "https://lichess.org", "Content-Type": "text/plain"}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://localhost:8080/api/run", strings.NewReader("{}"))
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
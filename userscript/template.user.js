@@ -17,7 +17,9 @@
         autoMove: {{.AutoMove}},         // true or false
         arrowColor: '{{.ArrowColor}}',   // hex color for arrows
         externalEngineURL: '{{.ExternalEngineURL}}',
-        externalEnginePassKey: '{{.PassKey}}'
+        externalEnginePassKey: '{{.PassKey}}',
+        depth: {{.Depth}},               // search depth to request from the engine
+        multiPV: {{.MultiPV}}            // number of principal variations the engine is configured for
     };
 
     let lastFen = '';
@@ -52,6 +54,7 @@
             self.locked = false;
             self.subscribed = false;
             self.currentFen = '';
+            self.resumeToken = '';
 
             self.connect = (url, passkey) => {
                 self.ws = new WebSocket(url);
@@ -63,11 +66,17 @@
                     console.log('Engine:', msg);
                     
                     if (msg === 'whoareyou') {
-                        self.ws.send('iam chesshook');
+                        // Skip the handshake after a reconnect when the server still knows us
+                        self.ws.send(self.resumeToken ? 'resume ' + self.resumeToken : 'iam chesshook');
                     } else if (msg === 'auth required') {
                         self.ws.send('auth ' + passkey);
-                    } else if (msg === 'auth success') {
+                    } else if (msg === 'auth success' || msg === 'resume success') {
                         self.authenticated = true;
+                    } else if (msg.startsWith('resume token ')) {
+                        self.resumeToken = msg.split(' ')[2];
+                    } else if (msg.startsWith('error: invalid or expired resume token')) {
+                        self.resumeToken = '';
+                        self.ws.send('iam chesshook');
                     } else if (msg.startsWith('bestmove')) {
                         const move = msg.split(' ')[1];
                         self.postMessage({ type: 'BESTMOVE', payload: { move: move } });
@@ -146,7 +155,8 @@
                 type: 'GETMOVE',
                 payload: {
                     fen: fen,
-                    depth: 10,
+                    depth: config.depth,
+                    multiPV: config.multiPV,
                     thinkTime: 2000
                 }
             });